@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// attachmentDir keeps chat photos next to the profile pictures. Unlike those
+// it is not served publicly; getAttachment checks the caller first.
+var attachmentDir = filepath.Join("images", "attachments")
+
+// maxAttachmentSize limits a single uploaded photo.
+var maxAttachmentSize = int64(getEnvInt("ATTACHMENT_MAX_BYTES", 5<<20))
+
+// attachmentTypes maps the accepted image types, detected from the file
+// content rather than the name, to the stored extension.
+var attachmentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+func attachmentURL(messageID int) string {
+	return fmt.Sprintf("/api/attachment?messageId=%d", messageID)
+}
+
+// sendAttachment posts a photo to a conversation. The multipart form carries
+// matchesId, senderId, an optional caption and the file as image.
+func sendAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+	if err := r.ParseMultipartForm(maxAttachmentSize); err != nil {
+		handleInvalidRequest(w, "Invalid form data or file too large")
+		return
+	}
+
+	matchesID, err := strconv.Atoi(r.FormValue("matchesId"))
+	if err != nil {
+		handleInvalidRequest(w, "matchesId is required")
+		return
+	}
+	senderID, err := strconv.Atoi(r.FormValue("senderId"))
+	if err != nil {
+		handleInvalidRequest(w, "senderId is required")
+		return
+	}
+
+	ctx := context.Background()
+	caption := r.FormValue("caption")
+	verdict, err := screenMessage(ctx, senderID, caption)
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error screening caption: %v\n", err)
+		handleServerError(w, err, "Failed to send image")
+		return
+	}
+	if caption = verdict.Text; caption != "" {
+		if caption, err = validateMessageText(caption); err != nil {
+			writeClientError(w, err)
+			return
+		}
+	}
+
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		handleInvalidRequest(w, "image is required")
+		return
+	}
+	defer file.Close()
+	if header.Size > maxAttachmentSize {
+		handleInvalidRequest(w, "Image is too large")
+		return
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		handleInvalidRequest(w, "Invalid image")
+		return
+	}
+	ext, ok := attachmentTypes[http.DetectContentType(head[:n])]
+	if !ok {
+		handleInvalidRequest(w, "Only JPEG, PNG, GIF and WebP images are allowed")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		handleServerError(w, err, "Failed to read image")
+		return
+	}
+
+	userID1, userID2, err := openConversation(ctx, matchesID, senderID)
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error checking match: %v\n", err)
+		handleServerError(w, err, "Failed to send image")
+		return
+	}
+
+	path, err := saveAttachment(matchesID, ext, file)
+	if err != nil {
+		log.Printf("Error saving attachment: %v\n", err)
+		handleServerError(w, err, "Failed to save image")
+		return
+	}
+
+	m := Message{MatchesID: matchesID, SenderID: senderID, Message: caption, Kind: messageKindImage}
+	if err := insertMessage(ctx, &m, path, verdict, userID1, userID2); err != nil {
+		os.Remove(path)
+		log.Printf("Error inserting message: %v\n", err)
+		handleServerError(w, err, "Failed to send image")
+		return
+	}
+
+	response := map[string]interface{}{"id": m.ID, "message": m.Message, "senderId": m.SenderID, "kind": m.Kind, "attachmentUrl": m.AttachmentURL}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// saveAttachment writes an upload under a random name, so file names cannot
+// be guessed or collide.
+func saveAttachment(matchesID int, ext string, src io.Reader) (string, error) {
+	dir := filepath.Join(attachmentDir, strconv.Itoa(matchesID))
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", err
+	}
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, hex.EncodeToString(name)+ext)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, f.Close()
+}
+
+// getAttachment serves the photo of an image message to the two users of its
+// match only. The user comes from the session token, which an <img> tag
+// passes as the token query parameter.
+func getAttachment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	messageID, err := strconv.Atoi(r.URL.Query().Get("messageId"))
+	if err != nil {
+		handleInvalidRequest(w, "messageId is required")
+		return
+	}
+
+	var path *string
+	var participant bool
+	err = conn.QueryRow(context.Background(), `
+		SELECT msg.attachment_path, $2 IN (m.userid1, m.userid2)
+		FROM messages msg
+		JOIN matches m ON m.id = msg.matches_id
+		WHERE msg.id = $1
+	`, messageID, userID).Scan(&path, &participant)
+	if err == pgx.ErrNoRows {
+		handleNotFound(w, "Message not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching attachment: %v\n", err)
+		handleServerError(w, err, "Failed to retrieve image")
+		return
+	}
+	if !participant {
+		handleForbidden(w, "You are not part of this conversation")
+		return
+	}
+	if path == nil {
+		handleNotFound(w, "Attachment not found")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, *path)
+}
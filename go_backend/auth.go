@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Session tokens prove who is calling on endpoints that must not trust a
+// userId sent by the client: the live event streams and moderation. Login
+// and signup hand one out. A token is "<userId>.<expiry unix>.<signature>",
+// signed with HMAC-SHA256 and AUTH_SECRET, so every instance sharing the
+// secret accepts it without a session table.
+
+// sessionTTL is how long a token stays valid.
+var sessionTTL = time.Duration(getEnvInt("SESSION_TTL_HOURS", 24*30)) * time.Hour
+
+var authSecret = loadAuthSecret()
+
+var errInvalidToken = errors.New("invalid or expired token")
+
+func loadAuthSecret() []byte {
+	if secret := getEnv("AUTH_SECRET", ""); secret != "" {
+		return []byte(secret)
+	}
+	// Tanpa AUTH_SECRET token hilang saat restart dan tidak berlaku di instance lain
+	log.Println("AUTH_SECRET is not set; using a random secret for this process")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalf("Error generating auth secret: %v\n", err)
+	}
+	return secret
+}
+
+func signToken(payload string) string {
+	mac := hmac.New(sha256.New, authSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueToken returns a session token for userID valid for sessionTTL.
+func issueToken(userID int, now time.Time) string {
+	payload := fmt.Sprintf("%d.%d", userID, now.Add(sessionTTL).Unix())
+	return payload + "." + signToken(payload)
+}
+
+// verifyToken returns the user a token was issued to.
+func verifyToken(token string, now time.Time) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, errInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(signToken(payload))) {
+		return 0, errInvalidToken
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, errInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() >= expires {
+		return 0, errInvalidToken
+	}
+	return userID, nil
+}
+
+// requireSession returns the user of the request's session token, taken from
+// an "Authorization: Bearer" header or, for WebSocket and EventSource clients
+// that cannot set headers, a token query parameter. It writes a 401 response
+// and returns false when the token is missing or invalid, and a 403 when a
+// userId parameter names someone else.
+func requireSession(w http.ResponseWriter, r *http.Request) (int, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		handleUnauthorized(w, "Authentication required")
+		return 0, false
+	}
+	userID, err := verifyToken(token, time.Now())
+	if err != nil {
+		handleUnauthorized(w, "Invalid or expired token")
+		return 0, false
+	}
+	if v := r.URL.Query().Get("userId"); v != "" && v != strconv.Itoa(userID) {
+		handleForbidden(w, "Token does not belong to this user")
+		return 0, false
+	}
+	return userID, true
+}
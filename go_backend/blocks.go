@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// blockedBetween returns a SQL condition that is true when either user has
+// blocked the other.
+func blockedBetween(a, b string) string {
+	return fmt.Sprintf(`EXISTS (
+			SELECT 1
+			FROM blocks bl
+			WHERE (bl.blocker_id = %[1]s AND bl.blocked_id = %[2]s)
+			   OR (bl.blocker_id = %[2]s AND bl.blocked_id = %[1]s)
+		)`, a, b)
+}
+
+func blocksHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		listBlocks(w, r)
+	case http.MethodPost:
+		blockUser(w, r)
+	case http.MethodDelete:
+		unblockUser(w, r)
+	default:
+		handleInvalidRequest(w, "Method not allowed")
+	}
+}
+
+func listBlocks(w http.ResponseWriter, r *http.Request) {
+	type BlockedUser struct {
+		UserID    int       `json:"userId"`
+		Name      *string   `json:"name"`
+		ImagePet  *string   `json:"image_pet"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		handleInvalidRequest(w, "User ID is required")
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), `
+		SELECT u.id, u.name, u.image_pet, b.created_at
+		FROM blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`, userID)
+	if err != nil {
+		log.Printf("Error querying blocks: %v\n", err)
+		handleServerError(w, err, "Failed to retrieve blocked users")
+		return
+	}
+	defer rows.Close()
+
+	blocked := []BlockedUser{}
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.UserID, &b.Name, &b.ImagePet, &b.CreatedAt); err != nil {
+			log.Printf("Error scanning block: %v\n", err)
+			handleServerError(w, err, "Failed to scan blocked users")
+			return
+		}
+		blocked = append(blocked, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating blocks: %v\n", err)
+		handleServerError(w, err, "Error retrieving blocked users")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"blocked": blocked,
+	}); err != nil {
+		log.Printf("Error encoding response: %v\n", err)
+		handleServerError(w, err, "Failed to encode response")
+	}
+}
+
+func blockUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID    int `json:"userId"`
+		BlockedID int `json:"blockedId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.UserID == 0 || req.BlockedID == 0 {
+		handleInvalidRequest(w, "userId and blockedId are required")
+		return
+	}
+	if req.UserID == req.BlockedID {
+		handleInvalidRequest(w, "Cannot block yourself")
+		return
+	}
+
+	err := runSerializable(context.Background(), func(tx pgx.Tx) error {
+		ctx := context.Background()
+		_, err := tx.Exec(ctx, `
+			INSERT INTO blocks (blocker_id, blocked_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, req.UserID, req.BlockedID)
+		if err != nil {
+			return fmt.Errorf("inserting block: %w", err)
+		}
+
+		// Match yang masih aktif langsung ditutup
+		rows, err := tx.Query(ctx, `
+			UPDATE matches
+			SET status = 'closed', closed_at = now(), closed_by = $1, close_reason = 'blocked'
+			WHERE status = 'match'
+			  AND ((userid1 = $1 AND userid2 = $2) OR (userid1 = $2 AND userid2 = $1))
+			RETURNING id
+		`, req.UserID, req.BlockedID)
+		if err != nil {
+			return fmt.Errorf("closing matches: %w", err)
+		}
+		var closed []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			closed = append(closed, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, matchesID := range closed {
+			err := notifyUser(ctx, tx, req.BlockedID, "unmatched", map[string]interface{}{"matchesId": matchesID})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		handleNotFound(w, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error blocking user: %v\n", err)
+		handleServerError(w, err, "Failed to block user")
+		return
+	}
+
+	response := map[string]interface{}{"message": "User blocked successfully", "blockedId": req.BlockedID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func unblockUser(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("userId"))
+	if err != nil {
+		handleInvalidRequest(w, "userId is required")
+		return
+	}
+	blockedID, err := strconv.Atoi(r.URL.Query().Get("blockedId"))
+	if err != nil {
+		handleInvalidRequest(w, "blockedId is required")
+		return
+	}
+
+	tag, err := conn.Exec(context.Background(), "DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2", userID, blockedID)
+	if err != nil {
+		log.Printf("Error deleting block: %v\n", err)
+		handleServerError(w, err, "Failed to unblock user")
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		handleNotFound(w, "Block not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "User unblocked successfully"}`))
+}
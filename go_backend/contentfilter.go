@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// User text (messages and bios) passes through a pipeline of content filters
+// before it is stored. Each filter finds the parts of the text belonging to
+// its category, and the action configured for that category decides what
+// happens: allow it, mask the parts with asterisks, store it but flag it for
+// moderation, or reject it. Actions are set per category with
+// CONTENT_FILTER_<CATEGORY>, e.g. CONTENT_FILTER_LINK=reject.
+const (
+	filterAllow  = "allow"
+	filterMask   = "mask"
+	filterFlag   = "flag"
+	filterReject = "reject"
+)
+
+// contentInput is the text to screen. Recent holds the spam hashes of the
+// author's recent messages for the spam filter and is empty for bios.
+type contentInput struct {
+	Text   string
+	Recent []string
+}
+
+// contentSpan is a byte range of the screened text.
+type contentSpan struct {
+	Start, End int
+}
+
+// contentFilter is one stage of the pipeline.
+type contentFilter interface {
+	Category() string
+	// Find returns the parts of in.Text that belong to the category.
+	Find(in contentInput) []contentSpan
+}
+
+// contentRule configures what a category does and how it is reported.
+type contentRule struct {
+	action string
+	// reason completes "... contains <reason>" in rejections.
+	reason string
+	// reportCategory is the reports category used when flagging.
+	reportCategory string
+}
+
+var contentRules = map[string]contentRule{
+	"profanity": {filterAction("profanity", filterMask), "offensive language", "inappropriate"},
+	"link":      {filterAction("link", filterFlag), "links", "spam"},
+	"phone":     {filterAction("phone", filterFlag), "phone numbers", "scam"},
+	"spam":      {filterAction("spam", filterReject), "a message you already sent several times", "spam"},
+}
+
+var contentFilters = []contentFilter{
+	wordFilter{"profanity", profanityWords},
+	regexpFilter{"link", linkPattern},
+	phoneFilter{},
+	repeatFilter{limit: getEnvInt("SPAM_REPEAT_LIMIT", 4)},
+}
+
+// spamRepeatWindow is how far back the spam filter looks for repeated
+// messages.
+var spamRepeatWindow = time.Duration(getEnvInt("SPAM_REPEAT_WINDOW_SECONDS", 600)) * time.Second
+
+func filterAction(category, fallback string) string {
+	key := "CONTENT_FILTER_" + strings.ToUpper(category)
+	switch action := strings.ToLower(getEnv(key, fallback)); action {
+	case filterAllow, filterMask, filterFlag, filterReject:
+		return action
+	default:
+		log.Printf("Invalid %s %q, using %s\n", key, action, fallback)
+		return fallback
+	}
+}
+
+// contentVerdict is the outcome of screening a text.
+type contentVerdict struct {
+	// Text is the text to store, with masked parts replaced.
+	Text string
+	// Flags are the categories to report to moderators.
+	Flags []string
+	// SpamHash identifies the original text for later spam checks; see
+	// spamHash.
+	SpamHash string
+}
+
+// screenContent runs in through contentFilters. It returns a client error
+// naming what (kind, e.g. "message") contains when a rejecting category
+// matches.
+func screenContent(kind string, in contentInput) (contentVerdict, error) {
+	return runContentFilters(contentFilters, contentRules, kind, in)
+}
+
+func runContentFilters(filters []contentFilter, rules map[string]contentRule, kind string, in contentInput) (contentVerdict, error) {
+	verdict := contentVerdict{Text: in.Text, SpamHash: spamHash(in.Text)}
+	var masked []contentSpan
+	for _, f := range filters {
+		rule, ok := rules[f.Category()]
+		if !ok || rule.action == filterAllow {
+			continue
+		}
+		spans := f.Find(in)
+		if len(spans) == 0 {
+			continue
+		}
+		switch rule.action {
+		case filterReject:
+			return verdict, &clientError{http.StatusBadRequest, fmt.Sprintf("Your %s contains %s, which is not allowed", kind, rule.reason)}
+		case filterMask:
+			masked = append(masked, spans...)
+		case filterFlag:
+			verdict.Flags = append(verdict.Flags, f.Category())
+		}
+	}
+	verdict.Text = maskSpans(in.Text, masked)
+	return verdict, nil
+}
+
+// maskSpans replaces every rune inside spans with an asterisk, so the text
+// keeps its length.
+func maskSpans(text string, spans []contentSpan) string {
+	if len(spans) == 0 {
+		return text
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+
+	var b strings.Builder
+	pos := 0
+	for _, s := range spans {
+		if s.End <= pos {
+			continue
+		}
+		if s.Start > pos {
+			b.WriteString(text[pos:s.Start])
+		} else {
+			s.Start = pos
+		}
+		b.WriteString(strings.Repeat("*", len([]rune(text[s.Start:s.End]))))
+		pos = s.End
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+// screenMessage screens a new message by senderID, including the spam check
+// against their messages of the last spamRepeatWindow.
+func screenMessage(ctx context.Context, senderID int, text string) (contentVerdict, error) {
+	recent, err := recentSpamHashes(ctx, senderID, 0)
+	if err != nil {
+		return contentVerdict{}, err
+	}
+	return screenContent("message", contentInput{Text: text, Recent: recent})
+}
+
+// recentSpamHashes returns the spam hashes of senderID's messages of the last
+// spamRepeatWindow, leaving out exceptID (the message being edited, if any).
+// Messages stored before spam_hash existed are hashed from their text, which
+// may already be masked.
+func recentSpamHashes(ctx context.Context, senderID, exceptID int) ([]string, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT spam_hash, message
+		FROM messages
+		WHERE sender_id = $1
+		  AND id <> $3
+		  AND (spam_hash IS NOT NULL OR message IS NOT NULL)
+		  AND created_at >= now() - $2::integer * interval '1 second'
+		ORDER BY created_at DESC
+		LIMIT 50
+	`, senderID, int(spamRepeatWindow.Seconds()), exceptID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching recent messages: %w", err)
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash, message *string
+		if err := rows.Scan(&hash, &message); err != nil {
+			return nil, err
+		}
+		if hash == nil {
+			hash = new(string)
+			*hash = spamHash(*message)
+		}
+		hashes = append(hashes, *hash)
+	}
+	return hashes, rows.Err()
+}
+
+// reportFlagged files a moderation report without a reporter for flagged
+// content by userID. messageID is nil for profile content.
+func reportFlagged(ctx context.Context, q querier, userID int, messageID *int, v contentVerdict) error {
+	for _, category := range v.Flags {
+		_, err := q.Exec(ctx, `
+			INSERT INTO reports (reported_user_id, message_id, category, details)
+			VALUES ($1, $2, $3, $4)
+		`, userID, messageID, contentRules[category].reportCategory, "Flagged automatically: "+category)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wordFilter matches whole words from a list, ignoring case and common
+// letter substitutions (sh1t, b@ngsat).
+type wordFilter struct {
+	category string
+	words    map[string]bool
+}
+
+func (f wordFilter) Category() string { return f.category }
+
+func (f wordFilter) Find(in contentInput) []contentSpan {
+	var spans []contentSpan
+	start := -1
+	check := func(end int) {
+		if start >= 0 && f.words[normalizeWord(in.Text[start:end])] {
+			spans = append(spans, contentSpan{start, end})
+		}
+		start = -1
+	}
+	for i, r := range in.Text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || leetLetters[r] != 0 {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		check(i)
+	}
+	check(len(in.Text))
+	return spans
+}
+
+var leetLetters = map[rune]rune{'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's'}
+
+func normalizeWord(word string) string {
+	return strings.Map(func(r rune) rune {
+		if l, ok := leetLetters[r]; ok {
+			return l
+		}
+		return unicode.ToLower(r)
+	}, word)
+}
+
+// profanityWords is a short English and Indonesian list. Animal names that
+// double as insults in Indonesian (anjing, babi, asu) are left out: on a pet
+// app they are almost always meant literally.
+var profanityWords = wordSet(
+	// English
+	"fuck", "fucking", "fucker", "fucked", "motherfucker", "shit", "shitty", "bullshit",
+	"bitch", "bitches", "asshole", "bastard", "cunt", "dickhead", "pussy",
+	"slut", "whore", "wanker", "retard",
+	// Indonesian
+	"bangsat", "bajingan", "brengsek", "kontol", "memek", "ngentot", "entot", "jancok",
+	"jancuk", "goblok", "goblog", "tolol", "kampret", "keparat", "pelacur", "lonte",
+	"perek", "taik",
+)
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+// regexpFilter matches a regular expression.
+type regexpFilter struct {
+	category string
+	pattern  *regexp.Regexp
+}
+
+func (f regexpFilter) Category() string { return f.category }
+
+func (f regexpFilter) Find(in contentInput) []contentSpan {
+	var spans []contentSpan
+	for _, loc := range f.pattern.FindAllStringIndex(in.Text, -1) {
+		spans = append(spans, contentSpan{loc[0], loc[1]})
+	}
+	return spans
+}
+
+// linkPattern matches URLs and bare domains such as wa.me/123 or bit.ly.
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9-]+(?:\.[a-z0-9-]+)*\.(?:com|net|org|id|co|io|me|ly|gg|app|xyz|info|biz|link|site)\b(?:/\S*)?`)
+
+// phoneFilter matches phone numbers: 9 to 15 digits, optionally starting
+// with +, written in one run or in groups separated by a single space, dot or
+// dash, with the area code optionally in parentheses. Groups after the first
+// have at least two digits, so "2026-03-01 16:00" and "Rp 150.000 - 200.000"
+// are not phone numbers, and neither are dates or amounts with thousand
+// separators.
+type phoneFilter struct{}
+
+func (phoneFilter) Category() string { return "phone" }
+
+var (
+	phoneCandidate = regexp.MustCompile(`\+?(?:\(\d+\)|\d+)(?:[ .-]?(?:\(\d+\)|\d+))*`)
+	phoneDigits    = regexp.MustCompile(`\d+`)
+	phoneDate      = regexp.MustCompile(`\d{4}-\d{1,2}-\d{1,2}|\d{1,2}[.-]\d{1,2}[.-]\d{4}`)
+	thousands      = regexp.MustCompile(`^\d{1,3}(?:\.\d{3})+$`)
+)
+
+func (phoneFilter) Find(in contentInput) []contentSpan {
+	var spans []contentSpan
+	for _, loc := range phoneCandidate.FindAllStringIndex(in.Text, -1) {
+		if isPhoneNumber(in.Text[loc[0]:loc[1]]) {
+			spans = append(spans, contentSpan{loc[0], loc[1]})
+		}
+	}
+	return spans
+}
+
+func isPhoneNumber(candidate string) bool {
+	if phoneDate.MatchString(candidate) || thousands.MatchString(candidate) {
+		return false
+	}
+	groups := phoneDigits.FindAllString(candidate, -1)
+	digits := 0
+	for i, g := range groups {
+		if i > 0 && len(g) < 2 {
+			return false
+		}
+		digits += len(g)
+	}
+	return digits >= 9 && digits <= 15
+}
+
+// repeatFilter matches a message when its author already sent the same text,
+// ignoring case, spacing and punctuation, limit-1 times recently. Short
+// replies such as "haha" or "ok" are repeated naturally and never count.
+type repeatFilter struct {
+	limit int
+}
+
+const spamMinLength = 10
+
+func (repeatFilter) Category() string { return "spam" }
+
+func (f repeatFilter) Find(in contentInput) []contentSpan {
+	if f.limit <= 0 || len([]rune(spamKey(in.Text))) < spamMinLength {
+		return nil
+	}
+	hash := spamHash(in.Text)
+	seen := 1
+	for _, prev := range in.Recent {
+		if prev == hash {
+			seen++
+		}
+	}
+	if seen < f.limit {
+		return nil
+	}
+	return []contentSpan{{0, len(in.Text)}}
+}
+
+func spamKey(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, text)
+}
+
+// spamHash is stored with every message so the spam filter can recognise a
+// repeated text even though the stored message may be masked or deleted. It
+// is a hash rather than the text so that deleting a message leaves no
+// readable copy behind. Empty texts have no hash.
+func spamHash(text string) string {
+	key := spamKey(text)
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// eventsChannel is the Postgres NOTIFY channel notifyUser announces new
+// notifications on. Every instance LISTENs on it and forwards each event to
+// the clients connected to that instance, so it does not matter which
+// instance handled the request that produced the event.
+const eventsChannel = "pawfectly_events"
+
+// ephemeralChannel carries events that are only useful while they happen,
+// like typing and presence. They are not stored and cannot be resumed.
+const ephemeralChannel = "pawfectly_ephemeral"
+
+// storedEvent is the NOTIFY payload built by notifyUser.
+type storedEvent struct {
+	ID        int64           `json:"id"`
+	UserID    int             `json:"userId"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+func (e storedEvent) chatEvent() chatEvent {
+	return chatEvent{ID: e.ID, Type: e.Type, Data: e.Data, CreatedAt: &e.CreatedAt}
+}
+
+// ephemeralEvent is the NOTIFY payload built by publishEphemeral.
+type ephemeralEvent struct {
+	UserIDs []int           `json:"userIds"`
+	Type    string          `json:"type"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// publishEphemeral sends an event to the live connections of userIDs on every
+// instance without storing it.
+func publishEphemeral(ctx context.Context, userIDs []int, kind string, data interface{}) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(ephemeralEvent{UserIDs: userIDs, Type: kind, Data: raw})
+	if err != nil {
+		return err
+	}
+	_, err = conn.Exec(ctx, "SELECT pg_notify($1, $2)", ephemeralChannel, string(payload))
+	return err
+}
+
+// eventCursor is how far the listener has read the notifications table.
+// Notifications commit out of id order, so after a disconnect catchUp cannot
+// just read ids above lastID: it re-reads everything created since
+// eventOverlap before lastAt and skips the ids in seen.
+type eventCursor struct {
+	lastID int64
+	lastAt time.Time
+	seen   map[int64]time.Time
+}
+
+// add records e and reports whether it is new.
+func (cur *eventCursor) add(e storedEvent) bool {
+	if _, ok := cur.seen[e.ID]; ok {
+		return false
+	}
+	cur.seen[e.ID] = e.CreatedAt
+	if e.ID > cur.lastID {
+		cur.lastID = e.ID
+	}
+	if e.CreatedAt.After(cur.lastAt) {
+		cur.lastAt = e.CreatedAt
+		// Id yang lebih tua dari jendela overlap tidak akan dibaca ulang
+		for id, at := range cur.seen {
+			if at.Before(cur.lastAt.Add(-eventOverlap)) {
+				delete(cur.seen, id)
+			}
+		}
+	}
+	return true
+}
+
+// listenForEvents keeps a dedicated connection LISTENing on eventsChannel and
+// ephemeralChannel and reconnects with backoff when it drops. Stored events
+// committed while it was disconnected are read back from the notifications
+// table; ephemeral ones are lost.
+func listenForEvents(ctx context.Context) {
+	cur := &eventCursor{seen: map[int64]time.Time{}}
+	backoff := time.Second
+	for {
+		connected, err := listenOnce(ctx, cur)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = time.Second
+		}
+		log.Printf("Event listener disconnected: %v; reconnecting in %s\n", err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// listenOnce runs a single LISTEN session. connected reports whether LISTEN
+// succeeded, so the caller can reset its backoff.
+func listenOnce(ctx context.Context, cur *eventCursor) (connected bool, err error) {
+	// LISTEN needs its own connection: a pooled one would be handed to other
+	// queries and miss notifications.
+	c, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		return false, err
+	}
+	defer c.Close(context.Background())
+
+	if _, err := c.Exec(ctx, "LISTEN "+eventsChannel+"; LISTEN "+ephemeralChannel); err != nil {
+		return false, err
+	}
+
+	// Susul event yang terlewat selama koneksi putus
+	if cur.lastAt.IsZero() {
+		err = c.QueryRow(ctx, "SELECT COALESCE(max(id), 0), now() FROM notifications").Scan(&cur.lastID, &cur.lastAt)
+	} else {
+		err = catchUp(ctx, c, cur)
+	}
+	if err != nil {
+		return true, err
+	}
+
+	for {
+		n, err := c.WaitForNotification(ctx)
+		if err != nil {
+			return true, err
+		}
+
+		if n.Channel == ephemeralChannel {
+			var e ephemeralEvent
+			if err := json.Unmarshal([]byte(n.Payload), &e); err != nil {
+				log.Printf("Error decoding event: %v\n", err)
+				continue
+			}
+			dispatchEphemeral(e)
+			continue
+		}
+
+		var e storedEvent
+		if err := json.Unmarshal([]byte(n.Payload), &e); err != nil {
+			log.Printf("Error decoding event: %v\n", err)
+			continue
+		}
+		dispatchEvent(e, cur)
+	}
+}
+
+func catchUp(ctx context.Context, c *pgx.Conn, cur *eventCursor) error {
+	rows, err := c.Query(ctx, `
+		SELECT id, user_id, type, payload, created_at
+		FROM notifications
+		WHERE id > $1 OR created_at >= $2
+		ORDER BY id
+	`, cur.lastID, cur.lastAt.Add(-eventOverlap))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e storedEvent
+		var payload string
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Type, &payload, &e.CreatedAt); err != nil {
+			return err
+		}
+		e.Data = json.RawMessage(payload)
+		dispatchEvent(e, cur)
+	}
+	return rows.Err()
+}
+
+func dispatchEvent(e storedEvent, cur *eventCursor) {
+	if !cur.add(e) {
+		return
+	}
+	hub.publish(e.UserID, e.chatEvent())
+}
+
+func dispatchEphemeral(e ephemeralEvent) {
+	for _, userID := range e.UserIDs {
+		hub.publish(userID, chatEvent{Type: e.Type, Data: e.Data})
+	}
+
+	// Instance lain bilang user offline, padahal di sini masih terhubung
+	if e.Type == "presence" {
+		var p struct {
+			UserID int  `json:"userId"`
+			Online bool `json:"online"`
+		}
+		if json.Unmarshal(e.Data, &p) == nil && !p.Online && hub.connected(p.UserID) {
+			go announcePresence(p.UserID, true)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// exportedMessage is one message of a conversation export.
+type exportedMessage struct {
+	ID         int        `json:"id"`
+	SenderID   int        `json:"senderId"`
+	SenderName string     `json:"senderName"`
+	Kind       string     `json:"kind"`
+	Message    string     `json:"message"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	EditedAt   *time.Time `json:"editedAt,omitempty"`
+	Deleted    bool       `json:"deleted,omitempty"`
+	// Playdate is set for playdate proposals.
+	Playdate *exportedPlaydate `json:"playdate,omitempty"`
+}
+
+// exportedPlaydate is the proposal carried by a playdate message.
+type exportedPlaydate struct {
+	StartsAt        time.Time `json:"startsAt"`
+	DurationMinutes int       `json:"durationMinutes"`
+	Place           string    `json:"place"`
+	Status          string    `json:"status"`
+}
+
+// exportConversation downloads a whole conversation as JSON (format=json,
+// the default) or plain text (format=text) for one of its participants.
+// Messages are written while they are read from the database, so long
+// conversations are never held in memory. Times in the text export use the
+// user's timezone.
+func exportConversation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	matchesID, err := strconv.Atoi(query.Get("matchesId"))
+	if err != nil {
+		handleInvalidRequest(w, "matchesId is required")
+		return
+	}
+	userID, err := strconv.Atoi(query.Get("userId"))
+	if err != nil {
+		handleInvalidRequest(w, "userId is required")
+		return
+	}
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "text" {
+		handleInvalidRequest(w, "format must be json or text")
+		return
+	}
+
+	ctx := r.Context()
+	if err := requireParticipant(ctx, matchesID, userID); err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error checking match: %v\n", err)
+		handleServerError(w, err, "Failed to export conversation")
+		return
+	}
+
+	var timezone string
+	if err := conn.QueryRow(ctx, "SELECT timezone FROM users WHERE id = $1", userID).Scan(&timezone); err != nil {
+		log.Printf("Error fetching user: %v\n", err)
+		handleServerError(w, err, "Failed to export conversation")
+		return
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+
+	// Pesan yang dihapus "untuk saya" juga tidak ikut diekspor
+	rows, err := conn.Query(ctx, `
+		SELECT msg.id, msg.sender_id, COALESCE(u.name, ''), msg.kind, COALESCE(msg.message, ''),
+		       msg.created_at, msg.edited_at, msg.deleted_at IS NOT NULL,
+		       p.starts_at, p.duration_minutes, p.place, p.status
+		FROM messages msg
+		LEFT JOIN users u ON u.id = msg.sender_id
+		LEFT JOIN playdates p ON p.message_id = msg.id AND msg.deleted_at IS NULL
+		WHERE msg.matches_id = $1
+		  AND NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = msg.id AND h.user_id = $2)
+		ORDER BY msg.created_at, msg.id
+	`, matchesID, userID)
+	if err != nil {
+		log.Printf("Error querying messages: %v\n", err)
+		handleServerError(w, err, "Failed to export conversation")
+		return
+	}
+	defer rows.Close()
+
+	ext, contentType := ".json", "application/json"
+	if format == "text" {
+		ext, contentType = ".txt", "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation-%d%s"`, matchesID, ext))
+
+	out := bufio.NewWriter(w)
+	if format == "json" {
+		err = writeExportJSON(out, rows, matchesID)
+	} else {
+		err = writeExportText(out, rows, loc)
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if err != nil {
+		// Header sudah terkirim, jadi cukup dicatat; unduhan akan terpotong
+		log.Printf("Error exporting conversation: %v\n", err)
+	}
+}
+
+func scanExportedMessage(rows pgx.Rows, m *exportedMessage) error {
+	var startsAt *time.Time
+	var duration *int
+	var place, status *string
+	err := rows.Scan(&m.ID, &m.SenderID, &m.SenderName, &m.Kind, &m.Message, &m.CreatedAt, &m.EditedAt, &m.Deleted,
+		&startsAt, &duration, &place, &status)
+	if err != nil {
+		return err
+	}
+	if startsAt != nil {
+		m.Playdate = &exportedPlaydate{StartsAt: *startsAt, DurationMinutes: *duration, Place: *place, Status: *status}
+	}
+	return nil
+}
+
+// writeExportJSON writes {"matchesId": ..., "exportedAt": ..., "messages": [...]}
+// one message at a time.
+func writeExportJSON(out *bufio.Writer, rows pgx.Rows, matchesID int) error {
+	fmt.Fprintf(out, `{"matchesId":%d,"exportedAt":%q,"messages":[`, matchesID, time.Now().UTC().Format(time.RFC3339))
+	enc := json.NewEncoder(out)
+	for first := true; rows.Next(); first = false {
+		var m exportedMessage
+		if err := scanExportedMessage(rows, &m); err != nil {
+			return err
+		}
+		if !first {
+			out.WriteByte(',')
+		}
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err := out.WriteString("]}\n")
+	return err
+}
+
+// writeExportText writes one line per message:
+//
+//	[2024-05-01 18:30 +07:00] Name: text
+//
+// Line breaks inside a message are indented, so every line that does not
+// start with a timestamp belongs to the message above it.
+func writeExportText(out *bufio.Writer, rows pgx.Rows, loc *time.Location) error {
+	for rows.Next() {
+		var m exportedMessage
+		if err := scanExportedMessage(rows, &m); err != nil {
+			return err
+		}
+		if _, err := out.WriteString(exportLine(m, loc)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exportTimeLayout is how times are written in the text export.
+const exportTimeLayout = "2006-01-02 15:04 -07:00"
+
+// exportLine formats one message of the text export, ending in a newline.
+func exportLine(m exportedMessage, loc *time.Location) string {
+	text := m.Message
+	switch {
+	case m.Deleted:
+		text = "(message deleted)"
+	case m.Kind == messageKindImage:
+		text = joinNonEmpty("[photo]", text)
+	case m.Kind == messageKindPlaydate && m.Playdate != nil:
+		p := m.Playdate
+		label := fmt.Sprintf("[playdate proposal: %s, %d min at %s, %s]",
+			p.StartsAt.In(loc).Format(exportTimeLayout), p.DurationMinutes, p.Place, p.Status)
+		text = joinNonEmpty(label, text)
+	case m.Kind == messageKindPlaydate:
+		text = joinNonEmpty("[playdate proposal]", text)
+	}
+	if m.EditedAt != nil && !m.Deleted {
+		text += " (edited)"
+	}
+
+	text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n")
+	text = strings.ReplaceAll(text, "\n", "\n    ")
+	return fmt.Sprintf("[%s] %s: %s\n", m.CreatedAt.In(loc).Format(exportTimeLayout), m.SenderName, text)
+}
+
+func joinNonEmpty(label, text string) string {
+	if text == "" {
+		return label
+	}
+	return label + " " + text
+}
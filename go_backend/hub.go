@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsSendBuffer = 32
+)
+
+// chatEvent is what the server pushes to connected clients. Events that come
+// from the notifications table carry its id, which clients pass back as since
+// when they reconnect.
+type chatEvent struct {
+	ID        int64       `json:"id,omitempty"`
+	Type      string      `json:"type"`
+	MatchesID int         `json:"matchesId,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt *time.Time  `json:"createdAt,omitempty"`
+}
+
+// hubClient is one live connection of a user, WebSocket or SSE. A user may
+// have several, e.g. one per browser tab, and every one of them receives the
+// user's events.
+type hubClient struct {
+	userID int
+	send   chan []byte
+}
+
+// wsClient is a hubClient backed by a WebSocket.
+type wsClient struct {
+	*hubClient
+	ws *websocket.Conn
+}
+
+type chatHub struct {
+	mu      sync.RWMutex
+	clients map[int]map[*hubClient]struct{}
+
+	// presence, when set, is called when a user's first connection to this
+	// instance opens (online) and when the last one closes.
+	presence func(userID int, online bool)
+}
+
+var hub = &chatHub{clients: make(map[int]map[*hubClient]struct{})}
+
+func (h *chatHub) register(c *hubClient) {
+	h.mu.Lock()
+	first := h.clients[c.userID] == nil
+	if first {
+		h.clients[c.userID] = make(map[*hubClient]struct{})
+	}
+	h.clients[c.userID][c] = struct{}{}
+	h.mu.Unlock()
+
+	if first && h.presence != nil {
+		h.presence(c.userID, true)
+	}
+}
+
+func (h *chatHub) unregister(c *hubClient) {
+	h.mu.Lock()
+	if _, ok := h.clients[c.userID][c]; !ok {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.clients[c.userID], c)
+	last := len(h.clients[c.userID]) == 0
+	if last {
+		delete(h.clients, c.userID)
+	}
+	close(c.send)
+	h.mu.Unlock()
+
+	if last && h.presence != nil {
+		h.presence(c.userID, false)
+	}
+}
+
+// connected reports whether userID has a connection to this instance.
+func (h *chatHub) connected(userID int) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[userID]) > 0
+}
+
+// connectedUsers returns the users with a connection to this instance.
+func (h *chatHub) connectedUsers() []int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ids := make([]int, 0, len(h.clients))
+	for id := range h.clients {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// publish sends event to every connection of userID. A connection that cannot
+// keep up is dropped instead of blocking the sender.
+func (h *chatHub) publish(userID int, event chatEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding event: %v\n", err)
+		return
+	}
+
+	h.mu.RLock()
+	var slow []*hubClient
+	for c := range h.clients[userID] {
+		select {
+		case c.send <- data:
+		default:
+			slow = append(slow, c)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, c := range slow {
+		log.Printf("Dropping slow client of user %d\n", userID)
+		h.unregister(c)
+	}
+}
+
+// publishTo sends event to a single connection.
+func (h *chatHub) publishTo(c *hubClient, event chatEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding event: %v\n", err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if _, ok := h.clients[c.userID][c]; !ok {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+	}
+}
+
+// requireActiveUser reports whether userID exists and may use the app,
+// writing the error response when it may not.
+func requireActiveUser(w http.ResponseWriter, userID int) bool {
+	var active bool
+	err := conn.QueryRow(context.Background(), "SELECT "+accountActive("users")+" FROM users WHERE id = $1", userID).Scan(&active)
+	if err == pgx.ErrNoRows {
+		handleNotFound(w, "User not found")
+		return false
+	}
+	if err != nil {
+		log.Printf("Error fetching user: %v\n", err)
+		handleServerError(w, err, "Failed to check account")
+		return false
+	}
+	if !active {
+		handleForbidden(w, "Account is not active")
+		return false
+	}
+	return true
+}
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range allowedOrigins {
+			if origin == allowed {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// chatSocket upgrades /api/ws?token=&since= to a WebSocket for the user of
+// the session token (see requireSession). The client receives the user's
+// events (new_message, new_match, ...) and can send messages and typing
+// indicators as that user with
+//
+//	{"type": "message", "matchesId": 1, "message": "hi"}
+//	{"type": "typing", "matchesId": 1, "typing": true}
+//
+// since is the id of the last event the client saw; everything it may have
+// missed is sent first (see eventsSince). Replayed and live events may
+// overlap, so clients skip ids they already have.
+func chatSocket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	var since int64
+	if s := r.URL.Query().Get("since"); s != "" {
+		var err error
+		since, err = strconv.ParseInt(s, 10, 64)
+		if err != nil || since < 0 {
+			handleInvalidRequest(w, "since must be an event id")
+			return
+		}
+	}
+
+	if !requireActiveUser(w, userID) {
+		return
+	}
+
+	matchesIDs, err := activeMatchIDs(context.Background(), userID)
+	if err != nil {
+		log.Printf("Error fetching matches: %v\n", err)
+		handleServerError(w, err, "Failed to open chat")
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade sudah menulis response error
+		log.Printf("Error upgrading WebSocket: %v\n", err)
+		return
+	}
+
+	c := &wsClient{hubClient: &hubClient{userID: userID, send: make(chan []byte, wsSendBuffer)}, ws: ws}
+	// Register before reading the backlog so nothing published in between is
+	// lost; live events wait in c.send until the backlog has been written.
+	hub.register(c.hubClient)
+
+	write := func(e chatEvent) error {
+		ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return ws.WriteJSON(e)
+	}
+	err = write(chatEvent{Type: "subscribed", Data: map[string]interface{}{"matchesIds": matchesIDs}})
+	if err == nil && since > 0 {
+		err = replayEvents(context.Background(), userID, since, write)
+	}
+	if err != nil {
+		log.Printf("Error sending missed events: %v\n", err)
+		hub.unregister(c.hubClient)
+		ws.Close()
+		return
+	}
+
+	go c.writePump()
+	c.readPump()
+}
+
+func activeMatchIDs(ctx context.Context, userID int) ([]int, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT id
+		FROM matches
+		WHERE status = 'match' AND (userid1 = $1 OR userid2 = $1)
+		ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// readPump handles messages sent by the client until the connection closes.
+func (c *wsClient) readPump() {
+	defer func() {
+		hub.unregister(c.hubClient)
+		c.ws.Close()
+	}()
+
+	c.ws.SetReadLimit(4096)
+	c.ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		var in struct {
+			Type      string `json:"type"`
+			MatchesID int    `json:"matchesId"`
+			Message   string `json:"message"`
+			Typing    bool   `json:"typing"`
+		}
+		if err := c.ws.ReadJSON(&in); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Error reading WebSocket: %v\n", err)
+			}
+			return
+		}
+
+		switch in.Type {
+		case "message":
+			_, err := createMessage(context.Background(), in.MatchesID, c.userID, in.Message)
+			if err != nil {
+				c.sendError(in.MatchesID, err)
+			}
+		case "typing":
+			if err := sendTyping(context.Background(), in.MatchesID, c.userID, in.Typing); err != nil {
+				c.sendError(in.MatchesID, err)
+			}
+		default:
+			c.sendError(in.MatchesID, &clientError{http.StatusBadRequest, "Unknown event type"})
+		}
+	}
+}
+
+func (c *wsClient) sendError(matchesID int, err error) {
+	code := http.StatusInternalServerError
+	message := "Failed to process event"
+	var ce *clientError
+	if errors.As(err, &ce) {
+		code, message = ce.code, ce.message
+	} else {
+		log.Printf("Error handling WebSocket event: %v\n", err)
+	}
+	hub.publishTo(c.hubClient, chatEvent{Type: "error", MatchesID: matchesID, Data: map[string]interface{}{"code": code, "message": message}})
+}
+
+// writePump is the only goroutine that writes to the connection.
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.ws.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				c.ws.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.ws.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// icsEvent is one VEVENT of an iCalendar file.
+type icsEvent struct {
+	UID         string
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Location    string
+	Description string
+	Updated     time.Time
+}
+
+// writeICS writes events as an RFC 5545 calendar. Times are written in UTC,
+// which every calendar app converts to the viewer's zone; timezone is only a
+// display hint for clients that honour X-WR-TIMEZONE.
+func writeICS(w io.Writer, name, timezone string, events []icsEvent) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Pawfectly//Playdates//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + icsEscape(name),
+	}
+	if timezone != "" {
+		lines = append(lines, "X-WR-TIMEZONE:"+icsEscape(timezone))
+	}
+	for _, e := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+e.UID,
+			"DTSTAMP:"+icsTime(e.Updated),
+			"DTSTART:"+icsTime(e.Start),
+			"DTEND:"+icsTime(e.End),
+			"SUMMARY:"+icsEscape(e.Summary),
+		)
+		if e.Location != "" {
+			lines = append(lines, "LOCATION:"+icsEscape(e.Location))
+		}
+		if e.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+icsEscape(e.Description))
+		}
+		lines = append(lines, "STATUS:CONFIRMED", "END:VEVENT")
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, icsFold(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// icsEscape escapes a TEXT value.
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// icsFold splits a content line into chunks of at most 75 octets, never
+// inside a UTF-8 sequence. Continuation lines start with a space.
+func icsFold(line string) string {
+	const limit = 75
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+// playdateEvents loads userID's accepted playdates, or only playdateID when it
+// is not zero, as calendar events.
+func playdateEvents(ctx context.Context, userID, playdateID int) ([]icsEvent, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT p.id, p.starts_at, p.duration_minutes, p.place, COALESCE(p.responded_at, p.created_at),
+		       COALESCE(me.name, ''), COALESCE(other.name, '')
+		FROM playdates p
+		JOIN matches m ON m.id = p.matches_id
+		JOIN users me ON me.id = $1
+		JOIN users other ON other.id = CASE WHEN m.userid1 = $1 THEN m.userid2 ELSE m.userid1 END
+		WHERE (m.userid1 = $1 OR m.userid2 = $1)
+		  AND p.status = 'accepted'
+		  AND ($2 = 0 OR p.id = $2)
+		ORDER BY p.starts_at, p.id
+	`, userID, playdateID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []icsEvent{}
+	for rows.Next() {
+		var id, minutes int
+		var start, updated time.Time
+		var place, me, other string
+		if err := rows.Scan(&id, &start, &minutes, &place, &updated, &me, &other); err != nil {
+			return nil, err
+		}
+		events = append(events, icsEvent{
+			UID:         fmt.Sprintf("playdate-%d@pawfectly", id),
+			Start:       start,
+			End:         start.Add(time.Duration(minutes) * time.Minute),
+			Summary:     "Playdate with " + other,
+			Location:    place,
+			Description: fmt.Sprintf("Pawfectly playdate between %s and %s.", me, other),
+			Updated:     updated,
+		})
+	}
+	return events, rows.Err()
+}
+
+// newCalendarKey returns a random secret that identifies a calendar feed.
+func newCalendarKey() (string, error) {
+	key := make([]byte, 24)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(key), nil
+}
+
+// calendarFeed returns the address of the session user's playdate feed,
+// creating its secret key on first use. POST replaces the key, so a leaked
+// address stops working. Calendar apps cannot send a session token, so the
+// feed is found by this key instead.
+func calendarFeed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := newCalendarKey()
+	if err != nil {
+		handleServerError(w, err, "Failed to create calendar")
+		return
+	}
+	update := "calendar_token = COALESCE(calendar_token, $2)"
+	if r.Method == http.MethodPost {
+		update = "calendar_token = $2"
+	}
+	err = conn.QueryRow(context.Background(), "UPDATE users SET "+update+" WHERE id = $1 RETURNING calendar_token", userID, key).Scan(&key)
+	if err == pgx.ErrNoRows {
+		handleNotFound(w, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving calendar key: %v\n", err)
+		handleServerError(w, err, "Failed to create calendar")
+		return
+	}
+
+	response := map[string]interface{}{"url": "/api/playdates/calendar.ics?key=" + key}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// playdateCalendar serves the accepted playdates of the user whose feed key
+// is given as an iCalendar feed that calendar apps can subscribe to.
+func playdateCalendar(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		handleInvalidRequest(w, "key is required")
+		return
+	}
+
+	var userID int
+	var timezone string
+	err := conn.QueryRow(context.Background(), "SELECT id, timezone FROM users WHERE calendar_token = $1", key).Scan(&userID, &timezone)
+	if err == pgx.ErrNoRows {
+		handleNotFound(w, "Calendar not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching user: %v\n", err)
+		handleServerError(w, err, "Failed to build calendar")
+		return
+	}
+	servePlaydateICS(w, userID, timezone, 0)
+}
+
+// playdateICS serves one of the session user's accepted playdates as a .ics
+// download.
+func playdateICS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+	playdateID, err := strconv.Atoi(r.URL.Query().Get("playdateId"))
+	if err != nil || playdateID <= 0 {
+		handleInvalidRequest(w, "playdateId is required")
+		return
+	}
+
+	var timezone string
+	err = conn.QueryRow(context.Background(), "SELECT timezone FROM users WHERE id = $1", userID).Scan(&timezone)
+	if err == pgx.ErrNoRows {
+		handleNotFound(w, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching user: %v\n", err)
+		handleServerError(w, err, "Failed to build calendar")
+		return
+	}
+	servePlaydateICS(w, userID, timezone, playdateID)
+}
+
+// servePlaydateICS writes userID's accepted playdates, or only playdateID
+// when it is not zero.
+func servePlaydateICS(w http.ResponseWriter, userID int, timezone string, playdateID int) {
+	single := playdateID != 0
+	events, err := playdateEvents(context.Background(), userID, playdateID)
+	if err != nil {
+		log.Printf("Error querying playdates: %v\n", err)
+		handleServerError(w, err, "Failed to build calendar")
+		return
+	}
+	if single && len(events) == 0 {
+		handleNotFound(w, "Playdate not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if single {
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="playdate-%d.ics"`, playdateID))
+	}
+	if err := writeICS(w, "Pawfectly playdates", timezone, events); err != nil {
+		log.Printf("Error writing calendar: %v\n", err)
+	}
+}
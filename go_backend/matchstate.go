@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// A matches row stores the decision of each side separately: decision1 is
+// userid1's swipe and decision2 is userid2's. status is derived from both:
+//
+//	either side passed          -> unmatch
+//	both sides liked            -> match
+//	otherwise                   -> pending
+//
+// A side may decide only once. Only undoSwipe can clear a decision again.
+// A match can be ended by either participant, which moves it to closed;
+// closed rows never change.
+const (
+	decisionLike      = "like"
+	decisionSuperLike = "superlike"
+	decisionPass      = "pass"
+)
+
+// swipeDecisions maps the status values accepted by setMatch to decisions.
+var swipeDecisions = map[string]string{
+	"match":     decisionLike,
+	"superlike": decisionSuperLike,
+	"unmatch":   decisionPass,
+}
+
+func isLike(decision *string) bool {
+	return decision != nil && (*decision == decisionLike || *decision == decisionSuperLike)
+}
+
+// matchStatus derives the status of a matches row from both decisions.
+func matchStatus(decision1, decision2 *string) string {
+	switch {
+	case (decision1 != nil && *decision1 == decisionPass) || (decision2 != nil && *decision2 == decisionPass):
+		return "unmatch"
+	case isLike(decision1) && isLike(decision2):
+		return "match"
+	default:
+		return "pending"
+	}
+}
+
+// runSerializable runs fn in a SERIALIZABLE transaction and retries it when
+// Postgres aborts it because of a concurrent swipe on the same pair.
+func runSerializable(ctx context.Context, fn func(pgx.Tx) error) error {
+	const maxAttempts = 5
+	for attempt := 1; ; attempt++ {
+		err := conn.BeginTxFunc(ctx, pgx.TxOptions{IsoLevel: pgx.Serializable}, fn)
+
+		var pgErr *pgconn.PgError
+		retryable := errors.As(err, &pgErr) &&
+			(pgErr.Code == "40001" || pgErr.Code == "40P01" || pgErr.Code == "23505")
+		if !retryable || attempt == maxAttempts {
+			return err
+		}
+	}
+}
+
+// swipeResult is the state of the pair after a swipe.
+type swipeResult struct {
+	matchesID int
+	status    string
+}
+
+// applySwipe records userID's decision about targetID. It must run inside
+// runSerializable so that concurrent swipes on the same pair cannot both
+// read the old state.
+func applySwipe(ctx context.Context, tx pgx.Tx, userID, targetID int, action string) (swipeResult, error) {
+	var result swipeResult
+	decision := swipeDecisions[action]
+
+	if decision == decisionSuperLike {
+		remaining, resetIn, err := superLikesRemaining(ctx, tx, userID)
+		if err != nil {
+			return result, err
+		}
+		if remaining <= 0 {
+			return result, &rateLimitExceeded{retryAfter: resetIn, message: "Daily super like quota reached"}
+		}
+	}
+
+	var blocked bool
+	err := tx.QueryRow(ctx, "SELECT "+blockedBetween("$1::integer", "$2::integer"), userID, targetID).Scan(&blocked)
+	if err != nil {
+		return result, fmt.Errorf("checking blocks: %w", err)
+	}
+	if blocked {
+		return result, &clientError{http.StatusForbidden, "You cannot interact with this user"}
+	}
+
+	var userID1 int
+	var decision1, decision2 *string
+	var previousStatus string
+	err = tx.QueryRow(ctx, `
+		SELECT id, userid1, decision1, decision2, status
+		FROM matches
+		WHERE (userid1 = $1 AND userid2 = $2)
+		   OR (userid1 = $2 AND userid2 = $1)
+		FOR UPDATE
+	`, userID, targetID).Scan(&result.matchesID, &userID1, &decision1, &decision2, &previousStatus)
+
+	switch {
+	case err == pgx.ErrNoRows:
+		result.status = matchStatus(&decision, nil)
+		err = tx.QueryRow(ctx, `
+			INSERT INTO matches (userid1, userid2, decision1, status)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, userID, targetID, decision, result.status).Scan(&result.matchesID)
+		if err != nil {
+			return result, fmt.Errorf("inserting match: %w", err)
+		}
+
+	case err != nil:
+		return result, fmt.Errorf("querying match: %w", err)
+
+	default:
+		if previousStatus == "closed" {
+			return result, &clientError{http.StatusConflict, "This match has been closed"}
+		}
+
+		own, column := &decision1, "decision1"
+		if userID1 != userID {
+			own, column = &decision2, "decision2"
+		}
+		if *own != nil {
+			return result, &clientError{http.StatusConflict, "You already swiped on this user"}
+		}
+		*own = &decision
+
+		result.status = matchStatus(decision1, decision2)
+		_, err = tx.Exec(ctx, fmt.Sprintf("UPDATE matches SET %s = $1, status = $2 WHERE id = $3", column),
+			decision, result.status, result.matchesID)
+		if err != nil {
+			return result, fmt.Errorf("updating match: %w", err)
+		}
+	}
+
+	if err := recordSwipe(ctx, tx, userID, targetID, result.matchesID, action, result.status); err != nil {
+		return result, fmt.Errorf("recording swipe: %w", err)
+	}
+
+	// Dua-duanya like: kabari kedua user
+	if result.status == "match" {
+		for _, u := range [][2]int{{userID, targetID}, {targetID, userID}} {
+			err := notifyUser(ctx, tx, u[0], "new_match", map[string]interface{}{"matchesId": result.matchesID, "userId": u[1]})
+			if err != nil {
+				return result, fmt.Errorf("sending match notification: %w", err)
+			}
+		}
+	}
+
+	if decision == decisionSuperLike {
+		err := notifyUser(ctx, tx, targetID, "super_like", map[string]interface{}{"userId": userID, "matchesId": result.matchesID})
+		if err != nil {
+			return result, fmt.Errorf("sending super like notification: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// closeMatch ends an active match on behalf of userID and tells the other
+// participant. reason is optional and only stored for moderation.
+func closeMatch(ctx context.Context, tx pgx.Tx, matchesID, userID int, reason string) error {
+	var userID1, userID2 int
+	var status string
+	err := tx.QueryRow(ctx, `
+		SELECT userid1, userid2, status
+		FROM matches
+		WHERE id = $1
+		FOR UPDATE
+	`, matchesID).Scan(&userID1, &userID2, &status)
+	if err == pgx.ErrNoRows {
+		return &clientError{http.StatusNotFound, "Match not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("fetching match: %w", err)
+	}
+
+	if userID != userID1 && userID != userID2 {
+		return &clientError{http.StatusForbidden, "You are not part of this match"}
+	}
+	if status != "match" {
+		return &clientError{http.StatusConflict, "Only an active match can be ended"}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE matches
+		SET status = 'closed', closed_at = now(), closed_by = $2, close_reason = NULLIF($3, '')
+		WHERE id = $1
+	`, matchesID, userID, reason)
+	if err != nil {
+		return fmt.Errorf("closing match: %w", err)
+	}
+
+	other := userID1
+	if other == userID {
+		other = userID2
+	}
+	return notifyUser(ctx, tx, other, "unmatched", map[string]interface{}{"matchesId": matchesID})
+}
+
+func unmatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		MatchesID int    `json:"matchesId"`
+		UserID    int    `json:"userId"`
+		Reason    string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.MatchesID == 0 || req.UserID == 0 {
+		handleInvalidRequest(w, "matchesId and userId are required")
+		return
+	}
+	if len([]rune(req.Reason)) > 255 {
+		handleInvalidRequest(w, "reason is too long")
+		return
+	}
+
+	err := runSerializable(context.Background(), func(tx pgx.Tx) error {
+		return closeMatch(context.Background(), tx, req.MatchesID, req.UserID, req.Reason)
+	})
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error closing match: %v\n", err)
+		handleServerError(w, err, "Failed to unmatch")
+		return
+	}
+
+	response := map[string]interface{}{"message": "Unmatched successfully", "matchesId": req.MatchesID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
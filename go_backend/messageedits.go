@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// messageEditWindow is how long after sending a message its sender can still
+// edit it. Deleting is allowed at any time.
+var messageEditWindow = time.Duration(getEnvInt("MESSAGE_EDIT_WINDOW_SECONDS", 900)) * time.Second
+
+// ownMessage is a message locked for an edit or delete by one of its
+// participants.
+type ownMessage struct {
+	Message
+	userID1, userID2 int
+	editable         bool
+	open             bool
+}
+
+// lockMessage loads messageID FOR UPDATE and checks that userID takes part in
+// its conversation.
+func lockMessage(ctx context.Context, tx pgx.Tx, messageID, userID int) (ownMessage, error) {
+	var om ownMessage
+	var status string
+	var blocked bool
+	err := tx.QueryRow(ctx, `
+		SELECT `+messageColumns+`,
+		       msg.created_at >= now() - $2::integer * interval '1 second',
+		       m.userid1, m.userid2, m.status, `+blockedBetween("m.userid1", "m.userid2")+`
+		FROM messages msg
+		JOIN matches m ON m.id = msg.matches_id
+		WHERE msg.id = $1
+		FOR UPDATE OF msg
+	`, messageID, int(messageEditWindow.Seconds())).Scan(
+		&om.ID, &om.MatchesID, &om.Message.Message, &om.SenderID, &om.CreatedAt, &om.EditedAt, &om.Deleted, &om.Kind,
+		&om.editable, &om.userID1, &om.userID2, &status, &blocked,
+	)
+	if err == pgx.ErrNoRows {
+		return om, &clientError{http.StatusNotFound, "Message not found"}
+	}
+	if err != nil {
+		return om, fmt.Errorf("fetching message: %w", err)
+	}
+	if userID != om.userID1 && userID != om.userID2 {
+		return om, &clientError{http.StatusForbidden, "You are not part of this conversation"}
+	}
+	om.open = status == "match" && !blocked
+	return om, nil
+}
+
+func editMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		MessageID int    `json:"messageId"`
+		UserID    int    `json:"userId"`
+		Message   string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.MessageID == 0 || req.UserID == 0 {
+		handleInvalidRequest(w, "messageId and userId are required")
+		return
+	}
+
+	ctx := context.Background()
+	recent, err := recentSpamHashes(ctx, req.UserID, req.MessageID)
+	if err != nil {
+		log.Printf("Error screening message: %v\n", err)
+		handleServerError(w, err, "Failed to edit message")
+		return
+	}
+	verdict, err := screenContent("message", contentInput{Text: req.Message, Recent: recent})
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+	text, err := validateMessageText(verdict.Text)
+	if err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	var edited Message
+	err = conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		om, err := lockMessage(ctx, tx, req.MessageID, req.UserID)
+		if err != nil {
+			return err
+		}
+		switch {
+		case om.SenderID != req.UserID:
+			return &clientError{http.StatusForbidden, "You can only edit your own messages"}
+		case om.Deleted:
+			return &clientError{http.StatusConflict, "Message has been deleted"}
+		case !om.open:
+			return &clientError{http.StatusForbidden, "This conversation is not open"}
+		case !om.editable:
+			return &clientError{http.StatusConflict, "Message can no longer be edited"}
+		}
+
+		edited = om.Message
+		if edited.Kind == messageKindImage {
+			edited.AttachmentURL = attachmentURL(edited.ID)
+		}
+		if text == edited.Message {
+			return nil
+		}
+
+		// Simpan versi lama sebagai riwayat edit
+		_, err = tx.Exec(ctx, "INSERT INTO message_edits (message_id, previous_message) VALUES ($1, $2)", om.ID, om.Message.Message)
+		if err != nil {
+			return fmt.Errorf("saving edit history: %w", err)
+		}
+		err = tx.QueryRow(ctx, "UPDATE messages SET message = $2, spam_hash = NULLIF($3, ''), edited_at = now() WHERE id = $1 RETURNING edited_at",
+			om.ID, text, verdict.SpamHash).Scan(&edited.EditedAt)
+		if err != nil {
+			return fmt.Errorf("updating message: %w", err)
+		}
+		edited.Message = text
+
+		for _, userID := range []int{om.userID1, om.userID2} {
+			if err := notifyUser(ctx, tx, userID, "message_edited", edited); err != nil {
+				return fmt.Errorf("publishing edit: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error editing message: %v\n", err)
+		handleServerError(w, err, "Failed to edit message")
+		return
+	}
+	if err := reportFlagged(ctx, conn, req.UserID, &req.MessageID, verdict); err != nil {
+		log.Printf("Error reporting flagged message: %v\n", err)
+	}
+
+	response := map[string]interface{}{"message": "Message edited", "data": edited}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// deleteMessage removes a message for the caller only (scope "me") or, for
+// its sender, for both participants (scope "everyone"). Deleting for
+// everyone keeps the row as a tombstone, drops its attachment and reactions
+// and replaces the message in stored events, so replays cannot bring the
+// text back. The last text is added to the edit history, which from then on
+// only the sender can read.
+func deleteMessage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		MessageID int    `json:"messageId"`
+		UserID    int    `json:"userId"`
+		Scope     string `json:"scope"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.MessageID == 0 || req.UserID == 0 {
+		handleInvalidRequest(w, "messageId and userId are required")
+		return
+	}
+	if req.Scope == "" {
+		req.Scope = "me"
+	}
+	if req.Scope != "me" && req.Scope != "everyone" {
+		handleInvalidRequest(w, "scope must be me or everyone")
+		return
+	}
+
+	ctx := context.Background()
+	var removedFile *string
+	err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		om, err := lockMessage(ctx, tx, req.MessageID, req.UserID)
+		if err != nil {
+			return err
+		}
+		payload := map[string]interface{}{"messageId": om.ID, "matchesId": om.MatchesID, "scope": req.Scope}
+
+		if req.Scope == "me" {
+			_, err = tx.Exec(ctx, `
+				INSERT INTO message_hides (message_id, user_id)
+				VALUES ($1, $2)
+				ON CONFLICT DO NOTHING
+			`, om.ID, req.UserID)
+			if err != nil {
+				return fmt.Errorf("hiding message: %w", err)
+			}
+			// Hanya perangkat lain milik user ini yang perlu tahu
+			return notifyUser(ctx, tx, req.UserID, "message_deleted", payload)
+		}
+
+		if om.SenderID != req.UserID {
+			return &clientError{http.StatusForbidden, "You can only delete your own messages for everyone"}
+		}
+		if om.Deleted {
+			return nil
+		}
+		if om.Message.Message != "" {
+			_, err = tx.Exec(ctx, "INSERT INTO message_edits (message_id, previous_message) VALUES ($1, $2)", om.ID, om.Message.Message)
+			if err != nil {
+				return fmt.Errorf("saving edit history: %w", err)
+			}
+		}
+		err = tx.QueryRow(ctx, `
+			WITH old AS (SELECT attachment_path FROM messages WHERE id = $1)
+			UPDATE messages SET message = NULL, attachment_path = NULL, deleted_at = now()
+			WHERE id = $1
+			RETURNING (SELECT attachment_path FROM old)
+		`, om.ID).Scan(&removedFile)
+		if err != nil {
+			return fmt.Errorf("deleting message: %w", err)
+		}
+		// Event lama yang merujuk pesan ini dan masih memuat teksnya: pesan itu
+		// sendiri (new_message, message_edited) atau event lain dengan messageId
+		_, err = tx.Exec(ctx, `
+			UPDATE notifications
+			SET payload = (payload - 'attachmentUrl') || jsonb_build_object('message', '', 'deleted', true)
+			WHERE user_id IN ($2, $3)
+			  AND ((type IN ('new_message', 'message_edited') AND payload @> jsonb_build_object('id', $1::integer))
+			       OR (payload @> jsonb_build_object('messageId', $1::integer) AND payload ? 'message'))
+		`, om.ID, om.userID1, om.userID2)
+		if err != nil {
+			return fmt.Errorf("scrubbing events: %w", err)
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM message_reactions WHERE message_id = $1", om.ID)
+		if err != nil {
+			return fmt.Errorf("deleting reactions: %w", err)
+		}
+		for _, userID := range []int{om.userID1, om.userID2} {
+			if err := notifyUser(ctx, tx, userID, "message_deleted", payload); err != nil {
+				return fmt.Errorf("publishing delete: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error deleting message: %v\n", err)
+		handleServerError(w, err, "Failed to delete message")
+		return
+	}
+	if removedFile != nil {
+		if err := os.Remove(*removedFile); err != nil {
+			log.Printf("Error removing attachment: %v\n", err)
+		}
+	}
+
+	response := map[string]interface{}{"message": "Message deleted", "messageId": req.MessageID, "scope": req.Scope}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// messageHistory returns the earlier versions of an edited message, oldest
+// first, to either participant. Once a message is deleted for everyone only
+// its sender can still read them.
+func messageHistory(w http.ResponseWriter, r *http.Request) {
+	type Edit struct {
+		Message  string    `json:"message"`
+		EditedAt time.Time `json:"editedAt"`
+	}
+
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	messageID, err := strconv.Atoi(r.URL.Query().Get("messageId"))
+	if err != nil {
+		handleInvalidRequest(w, "messageId is required")
+		return
+	}
+	userID, err := strconv.Atoi(r.URL.Query().Get("userId"))
+	if err != nil {
+		handleInvalidRequest(w, "userId is required")
+		return
+	}
+
+	var participant, hidden bool
+	err = conn.QueryRow(context.Background(), `
+		SELECT $2 IN (m.userid1, m.userid2), msg.deleted_at IS NOT NULL AND msg.sender_id <> $2
+		FROM messages msg
+		JOIN matches m ON m.id = msg.matches_id
+		WHERE msg.id = $1
+	`, messageID, userID).Scan(&participant, &hidden)
+	if err == pgx.ErrNoRows {
+		handleNotFound(w, "Message not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching message: %v\n", err)
+		handleServerError(w, err, "Failed to retrieve edit history")
+		return
+	}
+	if !participant {
+		handleForbidden(w, "You are not part of this conversation")
+		return
+	}
+	if hidden {
+		handleNotFound(w, "Message has been deleted")
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), `
+		SELECT previous_message, edited_at
+		FROM message_edits
+		WHERE message_id = $1
+		ORDER BY edited_at, id
+	`, messageID)
+	if err != nil {
+		log.Printf("Error querying message edits: %v\n", err)
+		handleServerError(w, err, "Failed to retrieve edit history")
+		return
+	}
+	defer rows.Close()
+
+	edits := []Edit{}
+	for rows.Next() {
+		var e Edit
+		if err := rows.Scan(&e.Message, &e.EditedAt); err != nil {
+			log.Printf("Error scanning message edit: %v\n", err)
+			handleServerError(w, err, "Failed to scan edit history")
+			return
+		}
+		edits = append(edits, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating message edits: %v\n", err)
+		handleServerError(w, err, "Error retrieving edit history")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"edits": edits,
+	}); err != nil {
+		log.Printf("Error encoding response: %v\n", err)
+		handleServerError(w, err, "Failed to encode response")
+	}
+}
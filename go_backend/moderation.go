@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var reportCategories = map[string]bool{
+	"spam":          true,
+	"harassment":    true,
+	"inappropriate": true,
+	"fake_profile":  true,
+	"scam":          true,
+	"other":         true,
+}
+
+// moderationActions maps a moderator decision to the resulting report status.
+var moderationActions = map[string]string{
+	"dismiss": "dismissed",
+	"warn":    "warned",
+	"suspend": "suspended",
+	"ban":     "banned",
+}
+
+// accountActive returns a SQL condition that is true when the user in alias
+// may log in and appear in discovery. Suspensions end on their own once
+// suspended_until has passed.
+func accountActive(alias string) string {
+	return fmt.Sprintf(`(%[1]s.account_status = 'active'
+			OR (%[1]s.account_status = 'suspended' AND %[1]s.suspended_until <= now()))`, alias)
+}
+
+// requireModerator returns the caller of a moderation endpoint, taken from
+// their session token, and checks that they have a moderator or admin role
+// and an active account. It writes the error response when they do not.
+func requireModerator(w http.ResponseWriter, r *http.Request) (int, bool) {
+	moderatorID, ok := requireSession(w, r)
+	if !ok {
+		return 0, false
+	}
+
+	var role string
+	var active bool
+	err := conn.QueryRow(context.Background(), "SELECT role, "+accountActive("users")+" FROM users WHERE id = $1", moderatorID).Scan(&role, &active)
+	if err == pgx.ErrNoRows {
+		handleNotFound(w, "User not found")
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("Error fetching role: %v\n", err)
+		handleServerError(w, err, "Failed to check permissions")
+		return 0, false
+	}
+	if (role != "moderator" && role != "admin") || !active {
+		handleForbidden(w, "Moderator access required")
+		return 0, false
+	}
+	return moderatorID, true
+}
+
+func reportUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		ReporterID     int    `json:"reporterId"`
+		ReportedUserID int    `json:"reportedUserId"`
+		MessageID      *int   `json:"messageId"`
+		Category       string `json:"category"`
+		Details        string `json:"details"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.ReporterID == 0 {
+		handleInvalidRequest(w, "reporterId is required")
+		return
+	}
+	if !reportCategories[req.Category] {
+		handleInvalidRequest(w, "category must be one of spam, harassment, inappropriate, fake_profile, scam, other")
+		return
+	}
+	if len([]rune(req.Details)) > 1000 {
+		handleInvalidRequest(w, "details is too long")
+		return
+	}
+
+	// Laporan pesan: pelapor harus ikut di percakapan, yang dilaporkan = pengirim pesan
+	if req.MessageID != nil {
+		var senderID, userID1, userID2 int
+		err := conn.QueryRow(context.Background(), `
+			SELECT msg.sender_id, m.userid1, m.userid2
+			FROM messages msg
+			JOIN matches m ON m.id = msg.matches_id
+			WHERE msg.id = $1
+		`, *req.MessageID).Scan(&senderID, &userID1, &userID2)
+		if err == pgx.ErrNoRows {
+			handleNotFound(w, "Message not found")
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching message: %v\n", err)
+			handleServerError(w, err, "Failed to create report")
+			return
+		}
+		if req.ReporterID != userID1 && req.ReporterID != userID2 {
+			handleForbidden(w, "You are not part of this conversation")
+			return
+		}
+		if senderID == req.ReporterID {
+			handleInvalidRequest(w, "Cannot report your own message")
+			return
+		}
+		req.ReportedUserID = senderID
+	}
+
+	if req.ReportedUserID == 0 {
+		handleInvalidRequest(w, "reportedUserId or messageId is required")
+		return
+	}
+	if req.ReportedUserID == req.ReporterID {
+		handleInvalidRequest(w, "Cannot report yourself")
+		return
+	}
+
+	var reportID int
+	err := conn.QueryRow(context.Background(), `
+		INSERT INTO reports (reporter_id, reported_user_id, message_id, category, details)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''))
+		RETURNING id
+	`, req.ReporterID, req.ReportedUserID, req.MessageID, req.Category, req.Details).Scan(&reportID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		handleNotFound(w, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error inserting report: %v\n", err)
+		handleServerError(w, err, "Failed to create report")
+		return
+	}
+
+	response := map[string]interface{}{"message": "Report submitted", "reportId": reportID}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func listReports(w http.ResponseWriter, r *http.Request) {
+	type Report struct {
+		ID               int        `json:"id"`
+		ReporterID       *int       `json:"reporterId"`
+		ReportedUserID   int        `json:"reportedUserId"`
+		ReportedName     *string    `json:"reportedName"`
+		ReportedStatus   string     `json:"reportedAccountStatus"`
+		MessageID        *int       `json:"messageId"`
+		Message          *string    `json:"message"`
+		Category         string     `json:"category"`
+		Details          *string    `json:"details"`
+		Status           string     `json:"status"`
+		ModeratorID      *int       `json:"moderatorId"`
+		ResolutionNote   *string    `json:"resolutionNote"`
+		CreatedAt        time.Time  `json:"createdAt"`
+		ResolvedAt       *time.Time `json:"resolvedAt"`
+		OpenReportsCount int        `json:"openReportsCount"`
+	}
+
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	if _, ok := requireModerator(w, r); !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+
+	rows, err := conn.Query(context.Background(), `
+		SELECT r.id, r.reporter_id, r.reported_user_id, u.name, u.account_status, r.message_id, msg.message,
+		       r.category, r.details, r.status, r.moderator_id, r.resolution_note, r.created_at, r.resolved_at,
+		       (SELECT count(*) FROM reports o WHERE o.reported_user_id = r.reported_user_id AND o.status = 'open')
+		FROM reports r
+		JOIN users u ON u.id = r.reported_user_id
+		LEFT JOIN messages msg ON msg.id = r.message_id
+		WHERE r.status = $1
+		ORDER BY r.created_at
+		LIMIT 100
+	`, status)
+	if err != nil {
+		log.Printf("Error querying reports: %v\n", err)
+		handleServerError(w, err, "Failed to retrieve reports")
+		return
+	}
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next() {
+		var rp Report
+		if err := rows.Scan(&rp.ID, &rp.ReporterID, &rp.ReportedUserID, &rp.ReportedName, &rp.ReportedStatus, &rp.MessageID, &rp.Message,
+			&rp.Category, &rp.Details, &rp.Status, &rp.ModeratorID, &rp.ResolutionNote, &rp.CreatedAt, &rp.ResolvedAt, &rp.OpenReportsCount); err != nil {
+			log.Printf("Error scanning report: %v\n", err)
+			handleServerError(w, err, "Failed to scan reports")
+			return
+		}
+		reports = append(reports, rp)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating reports: %v\n", err)
+		handleServerError(w, err, "Error retrieving reports")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"reports": reports,
+	}); err != nil {
+		log.Printf("Error encoding response: %v\n", err)
+		handleServerError(w, err, "Failed to encode response")
+	}
+}
+
+func resolveReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		ReportID    int    `json:"reportId"`
+		Action      string `json:"action"`
+		Note        string `json:"note"`
+		SuspendDays int    `json:"suspendDays"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.ReportID == 0 {
+		handleInvalidRequest(w, "reportId is required")
+		return
+	}
+	reportStatus, ok := moderationActions[req.Action]
+	if !ok {
+		handleInvalidRequest(w, "action must be one of dismiss, warn, suspend, ban")
+		return
+	}
+	if req.Action == "suspend" && req.SuspendDays <= 0 {
+		req.SuspendDays = 7
+	}
+	moderatorID, ok := requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.Background()
+	err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var reportedUserID int
+		err := tx.QueryRow(ctx, `
+			UPDATE reports
+			SET status = $2, moderator_id = $3, resolution_note = NULLIF($4, ''), resolved_at = now()
+			WHERE id = $1 AND status = 'open'
+			RETURNING reported_user_id
+		`, req.ReportID, reportStatus, moderatorID, req.Note).Scan(&reportedUserID)
+		if err == pgx.ErrNoRows {
+			return &clientError{http.StatusNotFound, "Open report not found"}
+		}
+		if err != nil {
+			return fmt.Errorf("updating report: %w", err)
+		}
+
+		switch req.Action {
+		case "warn":
+			_, err = tx.Exec(ctx, "UPDATE users SET warnings_count = warnings_count + 1 WHERE id = $1", reportedUserID)
+			if err == nil {
+				err = notifyUser(ctx, tx, reportedUserID, "warning", map[string]interface{}{"reportId": req.ReportID, "note": req.Note})
+			}
+		case "suspend":
+			// banned tidak boleh turun jadi suspended
+			_, err = tx.Exec(ctx, `
+				UPDATE users
+				SET account_status = 'suspended', suspended_until = now() + $2::integer * interval '1 day'
+				WHERE id = $1 AND account_status <> 'banned'
+			`, reportedUserID, req.SuspendDays)
+		case "ban":
+			_, err = tx.Exec(ctx, "UPDATE users SET account_status = 'banned', suspended_until = NULL WHERE id = $1", reportedUserID)
+		}
+		if err != nil {
+			return fmt.Errorf("applying %s: %w", req.Action, err)
+		}
+		return nil
+	})
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error resolving report: %v\n", err)
+		handleServerError(w, err, "Failed to resolve report")
+		return
+	}
+
+	response := map[string]interface{}{"message": "Report resolved", "reportId": req.ReportID, "status": reportStatus}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
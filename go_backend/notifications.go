@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type Notification struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// notifyUser stores a notification for userID. payload is encoded as JSON.
+// The row is also announced on eventsChannel, so every instance can push it
+// to the user's live connections once the surrounding transaction commits.
+func notifyUser(ctx context.Context, q querier, userID int, kind string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		WITH n AS (
+			INSERT INTO notifications (user_id, type, payload)
+			VALUES ($1, $2, $3)
+			RETURNING id, user_id, type, payload, created_at
+		)
+		SELECT pg_notify($4, json_build_object(
+			'id', n.id, 'userId', n.user_id, 'type', n.type, 'data', n.payload, 'createdAt', n.created_at
+		)::text)
+		FROM n
+	`, userID, kind, string(data), eventsChannel)
+	return err
+}
+
+// eventOverlap covers the gap between taking a notification id and
+// committing it. Ids come from a sequence when the row is inserted, but the
+// row only becomes visible when its transaction commits, so an event can
+// appear after one with a higher id has already been read. Catch-up
+// therefore re-reads events created up to eventOverlap before the cursor and
+// readers skip ids they already have.
+const eventOverlap = time.Minute
+
+// eventPageSize is how many events eventsSince reads at once.
+const eventPageSize = 500
+
+// eventsSince returns one page of userID's notifications for a client whose
+// last seen event is since, oldest first, and whether more remain. The first
+// page is read with after = 0 and the next with after = the id of the last
+// event returned. Besides the events after since it includes those created
+// up to eventOverlap before it, some of which the client may already have.
+func eventsSince(ctx context.Context, userID int, since, after int64) ([]chatEvent, bool, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT id, type, payload, created_at
+		FROM notifications
+		WHERE user_id = $1
+		  AND (id > $2 OR created_at >= (SELECT created_at FROM notifications WHERE id = $2) - $3::integer * interval '1 second')
+		  AND id > $4
+		ORDER BY id
+		LIMIT $5
+	`, userID, since, int(eventOverlap.Seconds()), after, eventPageSize+1)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	events := []chatEvent{}
+	for rows.Next() {
+		var e chatEvent
+		var payload string
+		var createdAt time.Time
+		if err := rows.Scan(&e.ID, &e.Type, &payload, &createdAt); err != nil {
+			return nil, false, err
+		}
+		e.Data = json.RawMessage(payload)
+		e.CreatedAt = &createdAt
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(events) > eventPageSize
+	if hasMore {
+		events = events[:eventPageSize]
+	}
+	return events, hasMore, nil
+}
+
+// replayEvents passes every event userID missed since the event with id since
+// to write, page by page until the backlog is drained.
+func replayEvents(ctx context.Context, userID int, since int64, write func(chatEvent) error) error {
+	var after int64
+	for {
+		events, hasMore, err := eventsSince(ctx, userID, since, after)
+		if err != nil {
+			return err
+		}
+		for _, e := range events {
+			if err := write(e); err != nil {
+				return err
+			}
+			after = e.ID
+		}
+		if !hasMore {
+			return nil
+		}
+	}
+}
+
+// notificationTypes are the events listed by /api/notifications. The rest of
+// the event log (new_message, read, reaction, ...) only drives live clients.
+var notificationTypes = []string{"new_match", "super_like", "unmatched", "warning", "playdate_updated"}
+
+func listNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		handleInvalidRequest(w, "User ID is required")
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), `
+		SELECT id, type, payload, created_at
+		FROM notifications
+		WHERE user_id = $1 AND type = ANY($2)
+		ORDER BY id DESC
+		LIMIT 50
+	`, userID, notificationTypes)
+	if err != nil {
+		log.Printf("Error querying notifications: %v\n", err)
+		handleServerError(w, err, "Failed to retrieve notifications")
+		return
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		var payload string
+		if err := rows.Scan(&n.ID, &n.Type, &payload, &n.CreatedAt); err != nil {
+			log.Printf("Error scanning notification: %v\n", err)
+			handleServerError(w, err, "Failed to scan notifications")
+			return
+		}
+		n.Payload = json.RawMessage(payload)
+		notifications = append(notifications, n)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating notifications: %v\n", err)
+		handleServerError(w, err, "Error retrieving notifications")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+	}); err != nil {
+		log.Printf("Error encoding response: %v\n", err)
+		handleServerError(w, err, "Failed to encode response")
+	}
+}
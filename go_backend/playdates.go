@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// A playdate starts as a proposal message in a conversation. The other
+// participant accepts or declines it, or counter-proposes, which marks it
+// countered and posts a new proposal the first user can answer in turn.
+const (
+	playdateProposed  = "proposed"
+	playdateAccepted  = "accepted"
+	playdateDeclined  = "declined"
+	playdateCountered = "countered"
+
+	defaultPlaydateMinutes = 60
+	maxPlaydateMinutes     = 8 * 60
+)
+
+type Playdate struct {
+	ID              int        `json:"id"`
+	MatchesID       int        `json:"matchesId"`
+	MessageID       int        `json:"messageId"`
+	ProposerID      int        `json:"proposerId"`
+	StartsAt        time.Time  `json:"startsAt"`
+	DurationMinutes int        `json:"durationMinutes"`
+	Place           string     `json:"place"`
+	Status          string     `json:"status"`
+	CounterOf       *int       `json:"counterOf"`
+	RespondedAt     *time.Time `json:"respondedAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+const playdateColumns = `p.id, p.matches_id, p.message_id, p.proposer_id, p.starts_at, p.duration_minutes, p.place,
+			p.status, p.counter_of, p.responded_at, p.created_at`
+
+func scanPlaydate(row pgx.Row, p *Playdate) error {
+	return row.Scan(&p.ID, &p.MatchesID, &p.MessageID, &p.ProposerID, &p.StartsAt, &p.DurationMinutes, &p.Place,
+		&p.Status, &p.CounterOf, &p.RespondedAt, &p.CreatedAt)
+}
+
+// playdateRequest is the proposal part of sendMessage and respondPlaydate.
+type playdateRequest struct {
+	StartsAt        time.Time `json:"startsAt"`
+	Place           string    `json:"place"`
+	DurationMinutes int       `json:"durationMinutes"`
+}
+
+func (p *playdateRequest) validate() error {
+	p.Place = strings.TrimSpace(p.Place)
+	if p.DurationMinutes == 0 {
+		p.DurationMinutes = defaultPlaydateMinutes
+	}
+	switch {
+	case p.StartsAt.IsZero():
+		return &clientError{http.StatusBadRequest, "startsAt is required (RFC 3339)"}
+	case !p.StartsAt.After(time.Now()):
+		return &clientError{http.StatusBadRequest, "startsAt must be in the future"}
+	case p.Place == "":
+		return &clientError{http.StatusBadRequest, "place is required"}
+	case utf8.RuneCountInString(p.Place) > 255:
+		return &clientError{http.StatusBadRequest, "place is too long"}
+	case p.DurationMinutes < 15 || p.DurationMinutes > maxPlaydateMinutes:
+		return &clientError{http.StatusBadRequest, fmt.Sprintf("durationMinutes must be between 15 and %d", maxPlaydateMinutes)}
+	}
+	return nil
+}
+
+// proposePlaydate posts a playdate proposal message with an optional note,
+// which goes through the content filter like any other message.
+func proposePlaydate(ctx context.Context, matchesID, senderID int, note string, req playdateRequest) (Message, error) {
+	m := Message{MatchesID: matchesID, SenderID: senderID, Message: strings.TrimSpace(note), Kind: messageKindPlaydate}
+	var verdict contentVerdict
+	if m.Message != "" {
+		var err error
+		if verdict, err = screenMessage(ctx, senderID, m.Message); err != nil {
+			return m, err
+		}
+		if m.Message, err = validateMessageText(verdict.Text); err != nil {
+			return m, err
+		}
+	}
+	if err := req.validate(); err != nil {
+		return m, err
+	}
+
+	userID1, userID2, err := openConversation(ctx, matchesID, senderID)
+	if err != nil {
+		return m, err
+	}
+	err = conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		return insertProposal(ctx, tx, &m, req, nil, verdict, userID1, userID2)
+	})
+	return m, err
+}
+
+// insertProposal stores the proposal message m together with its playdate
+// and the reports for its flagged note.
+func insertProposal(ctx context.Context, tx pgx.Tx, m *Message, req playdateRequest, counterOf *int, verdict contentVerdict, userID1, userID2 int) error {
+	if err := storeMessage(ctx, tx, m, "", verdict.SpamHash); err != nil {
+		return err
+	}
+	if err := reportFlagged(ctx, tx, m.SenderID, &m.ID, verdict); err != nil {
+		return fmt.Errorf("reporting flagged message: %w", err)
+	}
+
+	var p Playdate
+	err := scanPlaydate(tx.QueryRow(ctx, `
+		INSERT INTO playdates AS p (matches_id, message_id, proposer_id, starts_at, duration_minutes, place, counter_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+playdateColumns,
+		m.MatchesID, m.ID, m.SenderID, req.StartsAt, req.DurationMinutes, req.Place, counterOf), &p)
+	if err != nil {
+		return fmt.Errorf("inserting playdate: %w", err)
+	}
+	m.Playdate = &p
+
+	return publishMessage(ctx, tx, m, userID1, userID2)
+}
+
+// attachPlaydates fills in the playdate of every proposal in messages.
+func attachPlaydates(ctx context.Context, messages []Message) error {
+	var ids []int
+	for _, m := range messages {
+		if m.Kind == messageKindPlaydate {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := conn.Query(ctx, "SELECT "+playdateColumns+" FROM playdates p WHERE p.message_id = ANY($1)", ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byMessage := make(map[int]*Playdate)
+	for rows.Next() {
+		var p Playdate
+		if err := scanPlaydate(rows, &p); err != nil {
+			return err
+		}
+		byMessage[p.MessageID] = &p
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Playdate = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// respondPlaydate lets the invited side accept, decline or counter a
+// proposal.
+func respondPlaydate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		PlaydateID int    `json:"playdateId"`
+		UserID     int    `json:"userId"`
+		Action     string `json:"action"`
+		Message    string `json:"message"`
+		playdateRequest
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.PlaydateID == 0 || req.UserID == 0 {
+		handleInvalidRequest(w, "playdateId and userId are required")
+		return
+	}
+	newStatus, ok := map[string]string{"accept": playdateAccepted, "decline": playdateDeclined, "counter": playdateCountered}[req.Action]
+	if !ok {
+		handleInvalidRequest(w, "action must be one of accept, decline, counter")
+		return
+	}
+	ctx := context.Background()
+	counter := Message{SenderID: req.UserID, Message: strings.TrimSpace(req.Message), Kind: messageKindPlaydate}
+	var verdict contentVerdict
+	if req.Action == "counter" {
+		if err := req.playdateRequest.validate(); err != nil {
+			writeClientError(w, err)
+			return
+		}
+		if counter.Message != "" {
+			var err error
+			if verdict, err = screenMessage(ctx, req.UserID, counter.Message); err != nil {
+				if writeClientError(w, err) {
+					return
+				}
+				log.Printf("Error screening message: %v\n", err)
+				handleServerError(w, err, "Failed to answer playdate")
+				return
+			}
+			if counter.Message, err = validateMessageText(verdict.Text); err != nil {
+				writeClientError(w, err)
+				return
+			}
+		}
+	}
+
+	var updated Playdate
+	err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		err := scanPlaydate(tx.QueryRow(ctx, "SELECT "+playdateColumns+" FROM playdates p WHERE p.id = $1 FOR UPDATE", req.PlaydateID), &updated)
+		if err == pgx.ErrNoRows {
+			return &clientError{http.StatusNotFound, "Playdate not found"}
+		}
+		if err != nil {
+			return fmt.Errorf("fetching playdate: %w", err)
+		}
+
+		userID1, userID2, err := openConversation(ctx, updated.MatchesID, req.UserID)
+		if err != nil {
+			return err
+		}
+		if updated.ProposerID == req.UserID {
+			return &clientError{http.StatusForbidden, "You cannot answer your own proposal"}
+		}
+		if updated.Status != playdateProposed {
+			return &clientError{http.StatusConflict, "This proposal has already been answered"}
+		}
+
+		err = tx.QueryRow(ctx, `
+			UPDATE playdates SET status = $2, responded_at = now()
+			WHERE id = $1
+			RETURNING status, responded_at
+		`, updated.ID, newStatus).Scan(&updated.Status, &updated.RespondedAt)
+		if err != nil {
+			return fmt.Errorf("updating playdate: %w", err)
+		}
+		for _, userID := range []int{userID1, userID2} {
+			if err := notifyUser(ctx, tx, userID, "playdate_updated", updated); err != nil {
+				return fmt.Errorf("publishing playdate: %w", err)
+			}
+		}
+
+		if req.Action == "counter" {
+			counter.MatchesID = updated.MatchesID
+			return insertProposal(ctx, tx, &counter, req.playdateRequest, &updated.ID, verdict, userID1, userID2)
+		}
+		return nil
+	})
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error answering playdate: %v\n", err)
+		handleServerError(w, err, "Failed to answer playdate")
+		return
+	}
+
+	response := map[string]interface{}{"message": "Playdate " + updated.Status, "playdate": updated}
+	if req.Action == "counter" {
+		response["counterProposal"] = counter
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// listPlaydates returns a user's playdates with the other participant,
+// accepted ones by default and only those that have not ended unless
+// past=true.
+func listPlaydates(w http.ResponseWriter, r *http.Request) {
+	type PlaydateEntry struct {
+		Playdate
+		PartnerID   int     `json:"partnerId"`
+		PartnerName *string `json:"partnerName"`
+	}
+
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	userID := r.URL.Query().Get("userId")
+	if userID == "" {
+		handleInvalidRequest(w, "userId is required")
+		return
+	}
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = playdateAccepted
+	}
+	past := r.URL.Query().Get("past") == "true"
+
+	rows, err := conn.Query(context.Background(), `
+		SELECT `+playdateColumns+`, u.id, u.name
+		FROM playdates p
+		JOIN matches m ON m.id = p.matches_id
+		JOIN users u ON u.id = CASE WHEN m.userid1 = $1 THEN m.userid2 ELSE m.userid1 END
+		WHERE (m.userid1 = $1 OR m.userid2 = $1)
+		  AND p.status = $2
+		  AND ($3 OR p.starts_at + p.duration_minutes * interval '1 minute' >= now())
+		ORDER BY p.starts_at, p.id
+	`, userID, status, past)
+	if err != nil {
+		log.Printf("Error querying playdates: %v\n", err)
+		handleServerError(w, err, "Failed to retrieve playdates")
+		return
+	}
+	defer rows.Close()
+
+	playdates := []PlaydateEntry{}
+	for rows.Next() {
+		var e PlaydateEntry
+		p := &e.Playdate
+		if err := rows.Scan(&p.ID, &p.MatchesID, &p.MessageID, &p.ProposerID, &p.StartsAt, &p.DurationMinutes, &p.Place,
+			&p.Status, &p.CounterOf, &p.RespondedAt, &p.CreatedAt, &e.PartnerID, &e.PartnerName); err != nil {
+			log.Printf("Error scanning playdate: %v\n", err)
+			handleServerError(w, err, "Failed to scan playdates")
+			return
+		}
+		playdates = append(playdates, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating playdates: %v\n", err)
+		handleServerError(w, err, "Error retrieving playdates")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"playdates": playdates,
+	}); err != nil {
+		log.Printf("Error encoding response: %v\n", err)
+		handleServerError(w, err, "Failed to encode response")
+	}
+}
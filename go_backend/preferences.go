@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Preferences describes what an owner is looking for. Empty lists and nil
+// values mean "any".
+type Preferences struct {
+	UserID        int      `json:"id"`
+	PetTypes      []string `json:"petTypes"`
+	PetBreeds     []string `json:"petBreeds"`
+	Gender        string   `json:"gender"`
+	MinAge        *int     `json:"minAge"`
+	MaxAge        *int     `json:"maxAge"`
+	MaxDistanceKm *int     `json:"maxDistanceKm"`
+	Intent        string   `json:"intent"`
+	RequireMutual bool     `json:"requireMutual"`
+}
+
+var validIntents = map[string]bool{"any": true, "playdate": true, "breeding": true}
+
+// validGenders are the values a profile can store in users.gender. An empty
+// gender preference means "any".
+var validGenders = map[string]bool{"male": true, "female": true}
+
+// preferenceFilter returns a SQL condition that is true when target matches
+// the preferences pref declared by owner. A missing preferences row matches everyone.
+func preferenceFilter(pref, owner, target string) string {
+	return fmt.Sprintf(`(%[1]s.user_id IS NULL OR (
+			(cardinality(%[1]s.pet_types) = 0 OR lower(%[3]s.pet_type) = ANY(%[1]s.pet_types))
+			AND (cardinality(%[1]s.pet_breeds) = 0 OR lower(%[3]s.pet_breeds) = ANY(%[1]s.pet_breeds))
+			AND (%[1]s.gender IS NULL OR lower(%[3]s.gender) = %[1]s.gender)
+			AND (%[1]s.min_age IS NULL OR %[3]s.age >= %[1]s.min_age)
+			AND (%[1]s.max_age IS NULL OR %[3]s.age <= %[1]s.max_age)
+			AND (%[1]s.max_distance_km IS NULL OR %[2]s.latitude IS NULL OR %[3]s.latitude IS NULL
+				OR %[4]s <= %[1]s.max_distance_km)
+		))`, pref, owner, target, distanceKm(owner, target))
+}
+
+// intentFilter returns a SQL condition that is true when both sides want the
+// same kind of meeting, or at least one of them is open to anything.
+func intentFilter(a, b string) string {
+	return fmt.Sprintf(`(COALESCE(%[1]s.intent, 'any') = 'any' OR COALESCE(%[2]s.intent, 'any') = 'any' OR %[1]s.intent = %[2]s.intent)`, a, b)
+}
+
+// distanceKm returns the haversine distance between two users as a SQL expression.
+func distanceKm(a, b string) string {
+	return fmt.Sprintf(`(6371 * 2 * asin(sqrt(
+				power(sin(radians(%[2]s.latitude - %[1]s.latitude) / 2), 2)
+				+ cos(radians(%[1]s.latitude)) * cos(radians(%[2]s.latitude))
+				* power(sin(radians(%[2]s.longitude - %[1]s.longitude) / 2), 2))))`, a, b)
+}
+
+func preferencesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		getPreferences(w, r)
+	case http.MethodPut:
+		setPreferences(w, r)
+	default:
+		handleInvalidRequest(w, "Method not allowed")
+	}
+}
+
+func getPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		handleInvalidRequest(w, "User ID is required")
+		return
+	}
+
+	var prefs Preferences
+	var gender *string
+	err = conn.QueryRow(context.Background(), `
+		SELECT user_id, pet_types, pet_breeds, gender, min_age, max_age, max_distance_km, intent, require_mutual
+		FROM match_preferences
+		WHERE user_id = $1
+	`, userID).Scan(&prefs.UserID, &prefs.PetTypes, &prefs.PetBreeds, &gender, &prefs.MinAge, &prefs.MaxAge, &prefs.MaxDistanceKm, &prefs.Intent, &prefs.RequireMutual)
+	if err == pgx.ErrNoRows {
+		// belum pernah diisi, kembalikan preferensi default (semua cocok)
+		err = conn.QueryRow(context.Background(), "SELECT id FROM users WHERE id=$1", userID).Scan(&prefs.UserID)
+		if err != nil {
+			log.Printf("Error fetching user: %v\n", err)
+			handleNotFound(w, "User not found")
+			return
+		}
+		prefs.Intent = "any"
+	} else if err != nil {
+		log.Printf("Error fetching preferences: %v\n", err)
+		handleServerError(w, err, "Failed to fetch preferences")
+		return
+	}
+	if gender != nil {
+		prefs.Gender = *gender
+	}
+	if prefs.PetTypes == nil {
+		prefs.PetTypes = []string{}
+	}
+	if prefs.PetBreeds == nil {
+		prefs.PetBreeds = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(prefs); err != nil {
+		handleServerError(w, err, "Failed to encode response")
+	}
+}
+
+func setPreferences(w http.ResponseWriter, r *http.Request) {
+	var prefs Preferences
+	if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+
+	if prefs.UserID == 0 {
+		handleInvalidRequest(w, "User ID is required")
+		return
+	}
+	if prefs.Intent == "" {
+		prefs.Intent = "any"
+	}
+	if !validIntents[prefs.Intent] {
+		handleInvalidRequest(w, "intent must be one of any, playdate, breeding")
+		return
+	}
+	if (prefs.MinAge != nil && *prefs.MinAge < 0) || (prefs.MaxAge != nil && *prefs.MaxAge < 0) ||
+		(prefs.MinAge != nil && prefs.MaxAge != nil && *prefs.MinAge > *prefs.MaxAge) {
+		handleInvalidRequest(w, "Invalid age range")
+		return
+	}
+	if prefs.MaxDistanceKm != nil && *prefs.MaxDistanceKm <= 0 {
+		handleInvalidRequest(w, "maxDistanceKm must be positive")
+		return
+	}
+	prefs.Gender = strings.ToLower(strings.TrimSpace(prefs.Gender))
+	if prefs.Gender != "" && !validGenders[prefs.Gender] {
+		handleInvalidRequest(w, "gender must be male or female")
+		return
+	}
+	prefs.PetTypes = normalizeList(prefs.PetTypes)
+	prefs.PetBreeds = normalizeList(prefs.PetBreeds)
+
+	_, err := conn.Exec(context.Background(), `
+		INSERT INTO match_preferences (user_id, pet_types, pet_breeds, gender, min_age, max_age, max_distance_km, intent, require_mutual)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id) DO UPDATE SET
+			pet_types = EXCLUDED.pet_types,
+			pet_breeds = EXCLUDED.pet_breeds,
+			gender = EXCLUDED.gender,
+			min_age = EXCLUDED.min_age,
+			max_age = EXCLUDED.max_age,
+			max_distance_km = EXCLUDED.max_distance_km,
+			intent = EXCLUDED.intent,
+			require_mutual = EXCLUDED.require_mutual
+	`, prefs.UserID, prefs.PetTypes, prefs.PetBreeds, prefs.Gender, prefs.MinAge, prefs.MaxAge, prefs.MaxDistanceKm, prefs.Intent, prefs.RequireMutual)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		handleNotFound(w, "User not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving preferences: %v\n", err)
+		handleServerError(w, err, "Failed to save preferences")
+		return
+	}
+
+	response := map[string]interface{}{"message": "Preferences updated successfully", "preferences": prefs}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// normalizeList lowercases and trims values so they compare equal to the
+// lowercased profile columns, dropping empty entries.
+func normalizeList(values []string) []string {
+	normalized := []string{}
+	for _, v := range values {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			normalized = append(normalized, v)
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Presence is never stored beyond users.last_seen_at. While a user has a live
+// connection, its instance refreshes last_seen_at every presenceHeartbeat;
+// the user counts as online when it is younger than presenceTimeout. Live
+// "presence" events are sent to match partners when the first connection
+// opens and the last one closes, unless the user set hide_online.
+const (
+	presenceHeartbeat = 30 * time.Second
+	presenceTimeout   = 90 * time.Second
+)
+
+// matchPartners returns the users userID has an active, unblocked match with.
+func matchPartners(ctx context.Context, userID int) ([]int, error) {
+	rows, err := conn.Query(ctx, `
+		SELECT CASE WHEN m.userid1 = $1 THEN m.userid2 ELSE m.userid1 END
+		FROM matches m
+		WHERE m.status = 'match' AND (m.userid1 = $1 OR m.userid2 = $1)
+		  AND NOT `+blockedBetween("m.userid1", "m.userid2")+`
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// announcePresence records that userID came online or went offline on this
+// instance and tells the user's match partners.
+func announcePresence(userID int, online bool) {
+	ctx := context.Background()
+
+	var hidden bool
+	var lastSeenAt time.Time
+	err := conn.QueryRow(ctx, `
+		UPDATE users SET last_seen_at = now()
+		WHERE id = $1
+		RETURNING hide_online, last_seen_at
+	`, userID).Scan(&hidden, &lastSeenAt)
+	if err != nil {
+		log.Printf("Error updating last seen: %v\n", err)
+		return
+	}
+	if hidden {
+		return
+	}
+
+	partners, err := matchPartners(ctx, userID)
+	if err == nil {
+		err = publishEphemeral(ctx, partners, "presence", map[string]interface{}{
+			"userId":     userID,
+			"online":     online,
+			"lastSeenAt": lastSeenAt,
+		})
+	}
+	if err != nil {
+		log.Printf("Error announcing presence: %v\n", err)
+	}
+}
+
+// trackPresence refreshes last_seen_at of every user connected to this
+// instance.
+func trackPresence(interval time.Duration) {
+	for range time.Tick(interval) {
+		ids := hub.connectedUsers()
+		if len(ids) == 0 {
+			continue
+		}
+		_, err := conn.Exec(context.Background(), "UPDATE users SET last_seen_at = now() WHERE id = ANY($1)", ids)
+		if err != nil {
+			log.Printf("Error updating last seen: %v\n", err)
+		}
+	}
+}
+
+// sendTyping tells the other participant of a match that userID started or
+// stopped typing.
+func sendTyping(ctx context.Context, matchesID, userID int, typing bool) error {
+	var userID1, userID2 int
+	var status string
+	var blocked bool
+	err := conn.QueryRow(ctx, `
+		SELECT m.userid1, m.userid2, m.status, `+blockedBetween("m.userid1", "m.userid2")+`
+		FROM matches m
+		WHERE m.id = $1
+	`, matchesID).Scan(&userID1, &userID2, &status, &blocked)
+	if err == pgx.ErrNoRows {
+		return &clientError{http.StatusNotFound, "Match not found"}
+	}
+	if err != nil {
+		return fmt.Errorf("fetching match: %w", err)
+	}
+	if userID != userID1 && userID != userID2 {
+		return &clientError{http.StatusForbidden, "You are not part of this match"}
+	}
+	if status != "match" || blocked {
+		return &clientError{http.StatusForbidden, "This conversation has been closed"}
+	}
+
+	other := userID1
+	if other == userID {
+		other = userID2
+	}
+	return publishEphemeral(ctx, []int{other}, "typing", map[string]interface{}{
+		"matchesId": matchesID,
+		"userId":    userID,
+		"typing":    typing,
+	})
+}
+
+// typingHandler is the HTTP variant of the WebSocket "typing" event, for
+// clients on the SSE stream.
+func typingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		MatchesID int  `json:"matchesId"`
+		UserID    int  `json:"userId"`
+		Typing    bool `json:"typing"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.MatchesID == 0 || req.UserID == 0 {
+		handleInvalidRequest(w, "matchesId and userId are required")
+		return
+	}
+
+	if err := sendTyping(context.Background(), req.MatchesID, req.UserID, req.Typing); err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error sending typing event: %v\n", err)
+		handleServerError(w, err, "Failed to send typing event")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"message": "Typing event sent"}`))
+}
+
+// listPresence returns the presence of userId's match partners. Users who
+// hide their online status always appear offline without a last seen time.
+func listPresence(w http.ResponseWriter, r *http.Request) {
+	type Presence struct {
+		UserID     int        `json:"userId"`
+		MatchesID  int        `json:"matchesId"`
+		Online     bool       `json:"online"`
+		LastSeenAt *time.Time `json:"lastSeenAt"`
+	}
+
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("userId"))
+	if err != nil {
+		handleInvalidRequest(w, "userId is required")
+		return
+	}
+
+	rows, err := conn.Query(context.Background(), `
+		SELECT u.id, m.id,
+		       NOT u.hide_online AND u.last_seen_at >= now() - $2::integer * interval '1 second',
+		       CASE WHEN u.hide_online THEN NULL ELSE u.last_seen_at END
+		FROM matches m
+		JOIN users u ON u.id = CASE WHEN m.userid1 = $1 THEN m.userid2 ELSE m.userid1 END
+		WHERE m.status = 'match' AND (m.userid1 = $1 OR m.userid2 = $1)
+		  AND NOT `+blockedBetween("m.userid1", "m.userid2")+`
+		ORDER BY m.id
+	`, userID, int(presenceTimeout.Seconds()))
+	if err != nil {
+		log.Printf("Error querying presence: %v\n", err)
+		handleServerError(w, err, "Failed to retrieve presence")
+		return
+	}
+	defer rows.Close()
+
+	presence := []Presence{}
+	for rows.Next() {
+		var p Presence
+		var online *bool
+		if err := rows.Scan(&p.UserID, &p.MatchesID, &online, &p.LastSeenAt); err != nil {
+			log.Printf("Error scanning presence: %v\n", err)
+			handleServerError(w, err, "Failed to scan presence")
+			return
+		}
+		p.Online = online != nil && *online
+		presence = append(presence, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating presence: %v\n", err)
+		handleServerError(w, err, "Error retrieving presence")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"presence": presence,
+	}); err != nil {
+		log.Printf("Error encoding response: %v\n", err)
+		handleServerError(w, err, "Failed to encode response")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// rateLimit is a fixed-window counter stored in the rate_limits table, so it
+// survives restarts and is shared by every backend instance. windowStart and
+// windowEnd are SQL expressions evaluated with the user row aliased as u.
+type rateLimit struct {
+	bucket      string
+	limit       int
+	windowStart string
+	windowEnd   string
+	message     string
+	// refundable limits give the request back when it is undone.
+	refundable bool
+}
+
+var swipeLimits = []rateLimit{
+	{
+		bucket:      "swipe_minute",
+		limit:       getEnvInt("SWIPE_RATE_LIMIT_PER_MINUTE", 30),
+		windowStart: "date_trunc('minute', now())",
+		windowEnd:   "date_trunc('minute', now()) + interval '1 minute'",
+		message:     "Too many swipes, please slow down",
+	},
+	{
+		bucket:      "swipe_day",
+		limit:       getEnvInt("SWIPE_DAILY_LIMIT", 500),
+		windowStart: "date_trunc('day', now() AT TIME ZONE u.timezone) AT TIME ZONE u.timezone",
+		windowEnd:   "(date_trunc('day', now() AT TIME ZONE u.timezone) + interval '1 day') AT TIME ZONE u.timezone",
+		message:     "Daily swipe limit reached",
+		refundable:  true,
+	},
+}
+
+// rateLimitExceeded describes a rejected request and when it may be retried.
+type rateLimitExceeded struct {
+	retryAfter time.Duration
+	message    string
+}
+
+func (e *rateLimitExceeded) Error() string { return e.message }
+
+// hit counts one request against the limit for userID. A limit of zero or
+// less disables it.
+func (l rateLimit) hit(ctx context.Context, userID string) (*rateLimitExceeded, error) {
+	if l.limit <= 0 {
+		return nil, nil
+	}
+
+	var count int
+	var resetIn float64
+	err := conn.QueryRow(ctx, fmt.Sprintf(`
+		INSERT INTO rate_limits (user_id, bucket, window_start, window_end, count)
+		SELECT u.id, $2, %s, %s, 1
+		FROM users u
+		WHERE u.id = $1
+		ON CONFLICT (user_id, bucket) DO UPDATE SET
+			count = CASE WHEN rate_limits.window_start = EXCLUDED.window_start THEN rate_limits.count + 1 ELSE 1 END,
+			window_start = EXCLUDED.window_start,
+			window_end = EXCLUDED.window_end
+		RETURNING count, EXTRACT(EPOCH FROM window_end - now())::float8
+	`, l.windowStart, l.windowEnd), userID, l.bucket).Scan(&count, &resetIn)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > l.limit {
+		return &rateLimitExceeded{retryAfter: time.Duration(resetIn * float64(time.Second)), message: l.message}, nil
+	}
+	return nil, nil
+}
+
+// checkSwipeLimits counts a setMatch call against every swipe limit and
+// returns the first one that is exceeded.
+func checkSwipeLimits(ctx context.Context, userID string) (*rateLimitExceeded, error) {
+	for _, l := range swipeLimits {
+		exceeded, err := l.hit(ctx, userID)
+		if err != nil || exceeded != nil {
+			return exceeded, err
+		}
+	}
+	return nil, nil
+}
+
+// refund takes back one request made at madeAt, if it was counted in the
+// current window.
+func (l rateLimit) refund(ctx context.Context, q querier, userID int, madeAt time.Time) error {
+	_, err := q.Exec(ctx, `
+		UPDATE rate_limits
+		SET count = count - 1
+		WHERE user_id = $1 AND bucket = $2 AND count > 0
+		  AND window_start <= $3 AND window_end > $3
+	`, userID, l.bucket, madeAt)
+	return err
+}
+
+// refundSwipe gives an undone swipe made at swipedAt back to the refundable
+// swipe limits. The per-minute limit keeps it, so undo cannot be used to
+// swipe faster.
+func refundSwipe(ctx context.Context, q querier, userID int, swipedAt time.Time) error {
+	for _, l := range swipeLimits {
+		if !l.refundable {
+			continue
+		}
+		if err := l.refund(ctx, q, userID, swipedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
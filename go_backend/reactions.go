@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// reactionEmojis is the set of reactions a message can get.
+var reactionEmojis = map[string]bool{
+	"❤️": true,
+	"😂":  true,
+	"😮":  true,
+	"😢":  true,
+	"👍":  true,
+	"🐾":  true,
+}
+
+type Reaction struct {
+	UserID int    `json:"userId"`
+	Emoji  string `json:"emoji"`
+}
+
+// attachReactions fills in the reactions of messages.
+func attachReactions(ctx context.Context, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	ids := make([]int, len(messages))
+	for i, m := range messages {
+		ids[i] = m.ID
+	}
+
+	rows, err := conn.Query(ctx, `
+		SELECT message_id, user_id, emoji
+		FROM message_reactions
+		WHERE message_id = ANY($1)
+		ORDER BY created_at, user_id
+	`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byMessage := make(map[int][]Reaction)
+	for rows.Next() {
+		var messageID int
+		var re Reaction
+		if err := rows.Scan(&messageID, &re.UserID, &re.Emoji); err != nil {
+			return err
+		}
+		byMessage[messageID] = append(byMessage[messageID], re)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range messages {
+		messages[i].Reactions = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+// reactionsHandler sets (POST) or removes (DELETE) the caller's reaction to a
+// message. Each user has at most one reaction per message; posting another
+// emoji replaces it.
+func reactionsHandler(w http.ResponseWriter, r *http.Request) {
+	var messageID, userID int
+	var emoji *string
+
+	switch r.Method {
+	case http.MethodPost:
+		var req struct {
+			MessageID int    `json:"messageId"`
+			UserID    int    `json:"userId"`
+			Emoji     string `json:"emoji"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			handleInvalidRequest(w, "Invalid request payload")
+			return
+		}
+		if req.MessageID == 0 || req.UserID == 0 {
+			handleInvalidRequest(w, "messageId and userId are required")
+			return
+		}
+		if !reactionEmojis[req.Emoji] {
+			handleInvalidRequest(w, "Unsupported reaction")
+			return
+		}
+		messageID, userID, emoji = req.MessageID, req.UserID, &req.Emoji
+	case http.MethodDelete:
+		var err error
+		if messageID, err = strconv.Atoi(r.URL.Query().Get("messageId")); err != nil {
+			handleInvalidRequest(w, "messageId is required")
+			return
+		}
+		if userID, err = strconv.Atoi(r.URL.Query().Get("userId")); err != nil {
+			handleInvalidRequest(w, "userId is required")
+			return
+		}
+	default:
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	ctx := context.Background()
+	err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		om, err := lockMessage(ctx, tx, messageID, userID)
+		if err != nil {
+			return err
+		}
+		if om.Deleted {
+			return &clientError{http.StatusConflict, "Message has been deleted"}
+		}
+		if !om.open {
+			return &clientError{http.StatusForbidden, "This conversation is not open"}
+		}
+
+		if emoji == nil {
+			tag, err := tx.Exec(ctx, "DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2", messageID, userID)
+			if err != nil {
+				return fmt.Errorf("removing reaction: %w", err)
+			}
+			if tag.RowsAffected() == 0 {
+				return &clientError{http.StatusNotFound, "Reaction not found"}
+			}
+		} else {
+			_, err = tx.Exec(ctx, `
+				INSERT INTO message_reactions (message_id, user_id, emoji)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (message_id, user_id) DO UPDATE
+				SET emoji = EXCLUDED.emoji, created_at = now()
+			`, messageID, userID, *emoji)
+			if err != nil {
+				return fmt.Errorf("saving reaction: %w", err)
+			}
+		}
+
+		payload := map[string]interface{}{"messageId": messageID, "matchesId": om.MatchesID, "userId": userID, "emoji": emoji}
+		for _, u := range []int{om.userID1, om.userID2} {
+			if err := notifyUser(ctx, tx, u, "reaction", payload); err != nil {
+				return fmt.Errorf("publishing reaction: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error updating reaction: %v\n", err)
+		handleServerError(w, err, "Failed to update reaction")
+		return
+	}
+
+	response := map[string]interface{}{"message": "Reaction updated", "messageId": messageID, "emoji": emoji}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
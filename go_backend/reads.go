@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// unreadMessages returns a SQL expression counting the messages in match
+// alias that user has not read yet. Own messages never count as unread, and
+// neither do messages user cannot see: those deleted for everyone or hidden
+// by user.
+func unreadMessages(alias, user string) string {
+	return fmt.Sprintf(`(SELECT count(*)
+			FROM messages um
+			WHERE um.matches_id = %[1]s.id
+			  AND um.sender_id <> %[2]s
+			  AND um.deleted_at IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM message_hides uh WHERE uh.message_id = um.id AND uh.user_id = %[2]s)
+			  AND um.id > COALESCE((
+				SELECT mr.last_read_message_id
+				FROM match_reads mr
+				WHERE mr.matches_id = %[1]s.id AND mr.user_id = %[2]s
+			  ), 0))`, alias, user)
+}
+
+// markRead moves userId's read marker in a match forward to messageId, or to
+// the latest message when messageId is omitted. The other participant gets a
+// "read" event when the marker actually moved.
+func markRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	var req struct {
+		MatchesID int  `json:"matchesId"`
+		UserID    int  `json:"userId"`
+		MessageID *int `json:"messageId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		handleInvalidRequest(w, "Invalid request payload")
+		return
+	}
+	if req.MatchesID == 0 || req.UserID == 0 {
+		handleInvalidRequest(w, "matchesId and userId are required")
+		return
+	}
+
+	ctx := context.Background()
+	var lastRead *int
+	err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		var userID1, userID2 int
+		err := tx.QueryRow(ctx, "SELECT userid1, userid2 FROM matches WHERE id = $1", req.MatchesID).Scan(&userID1, &userID2)
+		if err == pgx.ErrNoRows {
+			return &clientError{http.StatusNotFound, "Match not found"}
+		}
+		if err != nil {
+			return fmt.Errorf("fetching match: %w", err)
+		}
+		if req.UserID != userID1 && req.UserID != userID2 {
+			return &clientError{http.StatusForbidden, "You are not part of this match"}
+		}
+
+		var messageID *int
+		if req.MessageID != nil {
+			err = tx.QueryRow(ctx, "SELECT id FROM messages WHERE id = $1 AND matches_id = $2", *req.MessageID, req.MatchesID).Scan(&messageID)
+			if err == pgx.ErrNoRows {
+				return &clientError{http.StatusNotFound, "Message not found"}
+			}
+		} else {
+			err = tx.QueryRow(ctx, "SELECT max(id) FROM messages WHERE matches_id = $1", req.MatchesID).Scan(&messageID)
+		}
+		if err != nil {
+			return fmt.Errorf("fetching message: %w", err)
+		}
+		if messageID == nil {
+			// Belum ada pesan, tidak ada yang perlu ditandai
+			return nil
+		}
+
+		// Penanda baca hanya boleh maju, tidak mundur
+		err = tx.QueryRow(ctx, `
+			INSERT INTO match_reads (matches_id, user_id, last_read_message_id)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (matches_id, user_id) DO UPDATE
+			SET last_read_message_id = EXCLUDED.last_read_message_id, read_at = now()
+			WHERE match_reads.last_read_message_id IS NULL
+			   OR match_reads.last_read_message_id < EXCLUDED.last_read_message_id
+			RETURNING last_read_message_id
+		`, req.MatchesID, req.UserID, *messageID).Scan(&lastRead)
+		if err == pgx.ErrNoRows {
+			// Penanda tidak maju, jadi tidak perlu memberi tahu user lain
+			return tx.QueryRow(ctx, "SELECT last_read_message_id FROM match_reads WHERE matches_id = $1 AND user_id = $2",
+				req.MatchesID, req.UserID).Scan(&lastRead)
+		}
+		if err != nil {
+			return fmt.Errorf("updating read marker: %w", err)
+		}
+
+		other := userID1
+		if other == req.UserID {
+			other = userID2
+		}
+		return notifyUser(ctx, tx, other, "read", map[string]interface{}{
+			"matchesId":         req.MatchesID,
+			"userId":            req.UserID,
+			"lastReadMessageId": *lastRead,
+		})
+	})
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error marking messages read: %v\n", err)
+		handleServerError(w, err, "Failed to mark messages as read")
+		return
+	}
+
+	response := map[string]interface{}{"message": "Messages marked as read", "matchesId": req.MatchesID, "lastReadMessageId": lastRead}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// unreadCount returns the number of unread messages over all of a user's
+// active conversations, for the badge on the chat tab.
+func unreadCount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("userId"))
+	if err != nil {
+		handleInvalidRequest(w, "userId is required")
+		return
+	}
+
+	var total, conversations int
+	err = conn.QueryRow(context.Background(), `
+		SELECT COALESCE(sum(unread), 0)::integer, count(*) FILTER (WHERE unread > 0)
+		FROM (
+			SELECT `+unreadMessages("m", "$1")+` AS unread
+			FROM matches m
+			WHERE m.status = 'match' AND (m.userid1 = $1 OR m.userid2 = $1)
+			  AND NOT `+blockedBetween("m.userid1", "m.userid2")+`
+		) t
+	`, userID).Scan(&total, &conversations)
+	if err != nil {
+		log.Printf("Error counting unread messages: %v\n", err)
+		handleServerError(w, err, "Failed to count unread messages")
+		return
+	}
+
+	response := map[string]interface{}{"unreadCount": total, "unreadConversations": conversations}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
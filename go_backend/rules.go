@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+)
+
+// Matching rules are Starlark scripts (*.star) placed in the rules directory.
+// A script may define either or both of:
+//
+//	def eligible(user, candidate): return True   # hide candidate when False
+//	def score(user, candidate): return 0          # higher scores are listed first
+//
+// user and candidate are frozen dicts with the same keys as /api/pets entries.
+// Scripts have no access to files or network, every call is limited in steps,
+// all calls for one feed request share a single wall-time budget, and the
+// directory is re-read whenever a file changes.
+
+type ruleScript struct {
+	name     string
+	eligible starlark.Callable
+	score    starlark.Callable
+}
+
+type matchRules struct {
+	dir      string
+	timeout  time.Duration
+	maxSteps uint64
+
+	mu       sync.RWMutex
+	scripts  []ruleScript
+	modTimes map[string]time.Time
+}
+
+var rules *matchRules
+
+func newMatchRules(dir string, timeout time.Duration, maxSteps uint64) *matchRules {
+	return &matchRules{dir: dir, timeout: timeout, maxSteps: maxSteps}
+}
+
+// active reports whether at least one script is loaded.
+func (m *matchRules) active() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.scripts) > 0
+}
+
+// reload loads the scripts again if any file in the directory was added,
+// removed or modified. When a script fails to load the previous rule set is kept.
+func (m *matchRules) reload() error {
+	files, err := filepath.Glob(filepath.Join(m.dir, "*.star"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	modTimes := make(map[string]time.Time, len(files))
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	m.mu.RLock()
+	unchanged := m.modTimes != nil && len(modTimes) == len(m.modTimes)
+	if unchanged {
+		for file, modTime := range modTimes {
+			if !m.modTimes[file].Equal(modTime) {
+				unchanged = false
+				break
+			}
+		}
+	}
+	m.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	var scripts []ruleScript
+	for _, file := range files {
+		script, err := m.load(file)
+		if err != nil {
+			return fmt.Errorf("loading %s: %w", file, err)
+		}
+		scripts = append(scripts, script)
+	}
+
+	m.mu.Lock()
+	m.scripts = scripts
+	m.modTimes = modTimes
+	m.mu.Unlock()
+
+	log.Printf("Loaded %d matching rule script(s) from %s\n", len(scripts), m.dir)
+	return nil
+}
+
+func (m *matchRules) load(file string) (ruleScript, error) {
+	script := ruleScript{name: filepath.Base(file)}
+
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return script, err
+	}
+
+	thread := m.newThread(script.name)
+	timer := time.AfterFunc(m.timeout, func() { thread.Cancel("timeout") })
+	defer timer.Stop()
+
+	globals, err := starlark.ExecFile(thread, script.name, src, nil)
+	if err != nil {
+		return script, err
+	}
+	// Frozen globals can be shared by concurrent requests.
+	globals.Freeze()
+
+	for name, target := range map[string]*starlark.Callable{"eligible": &script.eligible, "score": &script.score} {
+		value, ok := globals[name]
+		if !ok {
+			continue
+		}
+		fn, ok := value.(starlark.Callable)
+		if !ok {
+			return script, fmt.Errorf("%s is %s, not a function", name, value.Type())
+		}
+		*target = fn
+	}
+	return script, nil
+}
+
+func (m *matchRules) newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			log.Printf("rules %s: %s\n", thread.Name, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(m.maxSteps)
+	return thread
+}
+
+// watch polls the rules directory until the process exits.
+func (m *matchRules) watch(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := m.reload(); err != nil {
+			log.Printf("Error reloading matching rules: %v\n", err)
+		}
+	}
+}
+
+// evaluate runs every script against a candidate, stopping the calls at
+// deadline. A script that fails is logged and ignored so that a broken rule
+// never empties the feed.
+func (m *matchRules) evaluate(user, candidate map[string]interface{}, deadline time.Time) (bool, float64) {
+	m.mu.RLock()
+	scripts := m.scripts
+	m.mu.RUnlock()
+
+	args := starlark.Tuple{toStarlarkDict(user), toStarlarkDict(candidate)}
+	var total float64
+
+	for _, script := range scripts {
+		if script.eligible != nil {
+			result, err := m.call(script, script.eligible, args, deadline)
+			if err != nil {
+				log.Printf("Error evaluating eligible in %s: %v\n", script.name, err)
+			} else if !bool(result.Truth()) {
+				return false, 0
+			}
+		}
+
+		if script.score != nil {
+			result, err := m.call(script, script.score, args, deadline)
+			if err != nil {
+				log.Printf("Error evaluating score in %s: %v\n", script.name, err)
+				continue
+			}
+			value, ok := starlark.AsFloat(result)
+			if !ok {
+				log.Printf("Error evaluating score in %s: got %s, want number\n", script.name, result.Type())
+				continue
+			}
+			total += value
+		}
+	}
+
+	return true, total
+}
+
+func (m *matchRules) call(script ruleScript, fn starlark.Callable, args starlark.Tuple, deadline time.Time) (starlark.Value, error) {
+	thread := m.newThread(script.name)
+	timer := time.AfterFunc(time.Until(deadline), func() { thread.Cancel("timeout") })
+	defer timer.Stop()
+	return starlark.Call(thread, fn, args, nil)
+}
+
+// apply filters pets through the loaded rules and orders the remaining ones
+// by descending score, keeping the query order for ties. The whole request
+// gets m.timeout; candidates not reached by then are appended unscored in
+// query order.
+func (m *matchRules) apply(user map[string]interface{}, pets []map[string]interface{}) []map[string]interface{} {
+	type scoredPet struct {
+		pet   map[string]interface{}
+		score float64
+	}
+
+	deadline := time.Now().Add(m.timeout)
+	var eligible []scoredPet
+	var unscored []map[string]interface{}
+	for i, pet := range pets {
+		if !time.Now().Before(deadline) {
+			log.Printf("Matching rules timed out, %d of %d candidates left unscored\n", len(pets)-i, len(pets))
+			unscored = pets[i:]
+			break
+		}
+		if ok, score := m.evaluate(user, pet, deadline); ok {
+			eligible = append(eligible, scoredPet{pet, score})
+		}
+	}
+	sort.SliceStable(eligible, func(i, j int) bool { return eligible[i].score > eligible[j].score })
+
+	sorted := make([]map[string]interface{}, 0, len(eligible)+len(unscored))
+	for _, p := range eligible {
+		sorted = append(sorted, p.pet)
+	}
+	return append(sorted, unscored...)
+}
+
+func toStarlarkDict(values map[string]interface{}) *starlark.Dict {
+	dict := starlark.NewDict(len(values))
+	for key, value := range values {
+		dict.SetKey(starlark.String(key), toStarlarkValue(value))
+	}
+	dict.Freeze()
+	return dict
+}
+
+func toStarlarkValue(value interface{}) starlark.Value {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None
+	case bool:
+		return starlark.Bool(v)
+	case int:
+		return starlark.MakeInt(v)
+	case int64:
+		return starlark.MakeInt64(v)
+	case float64:
+		return starlark.Float(v)
+	case string:
+		return starlark.String(v)
+	case []string:
+		list := make([]starlark.Value, len(v))
+		for i, s := range v {
+			list[i] = starlark.String(s)
+		}
+		return starlark.NewList(list)
+	default:
+		return starlark.String(fmt.Sprint(v))
+	}
+}
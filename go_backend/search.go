@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchPageSize is the default and maxSearchPageSize the largest number of
+// hits searchMessages returns at once.
+const (
+	searchPageSize    = 20
+	maxSearchPageSize = 50
+)
+
+// searchMessages searches the messages of every conversation userId takes
+// part in, or only matchesId when given. Hits are newest first and can be
+// paged with before=<messageId of the last hit>.
+//
+// position is the hit's place in its conversation counted from the newest
+// message (1 is the newest), so with getMessages' page size limit the hit is
+// on page ceil(position / limit). The messages around it load with
+// getMessages?before=<messageId> and getMessages?after=<messageId>.
+func searchMessages(w http.ResponseWriter, r *http.Request) {
+	type SearchHit struct {
+		MessageID   int       `json:"messageId"`
+		MatchesID   int       `json:"matchesId"`
+		SenderID    int       `json:"senderId"`
+		PartnerID   int       `json:"partnerId"`
+		PartnerName *string   `json:"partnerName"`
+		Snippet     string    `json:"snippet"`
+		CreatedAt   time.Time `json:"createdAt"`
+		Position    int       `json:"position"`
+	}
+
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	query := r.URL.Query()
+	userID, err := strconv.Atoi(query.Get("userId"))
+	if err != nil {
+		handleInvalidRequest(w, "userId is required")
+		return
+	}
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		handleInvalidRequest(w, "q is required")
+		return
+	}
+	if len(q) > maxMessageLength {
+		handleInvalidRequest(w, "q is too long")
+		return
+	}
+
+	var matchesID, before int
+	if v := query.Get("matchesId"); v != "" {
+		if matchesID, err = strconv.Atoi(v); err != nil {
+			handleInvalidRequest(w, "Invalid matchesId")
+			return
+		}
+	}
+	if v := query.Get("before"); v != "" {
+		if before, err = strconv.Atoi(v); err != nil {
+			handleInvalidRequest(w, "Invalid message cursor")
+			return
+		}
+	}
+	limit := searchPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			handleInvalidRequest(w, "Invalid limit value")
+			return
+		}
+		limit = min(n, maxSearchPageSize)
+	}
+
+	// Pesan yang dihapus untuk semua orang tidak punya teks lagi, jadi
+	// search_vector-nya kosong; yang dihapus "untuk saya" disaring di sini
+	rows, err := conn.Query(context.Background(), `
+		WITH hits AS (
+			SELECT msg.id, msg.matches_id, msg.sender_id, msg.message, msg.created_at,
+			       CASE WHEN m.userid1 = $1 THEN m.userid2 ELSE m.userid1 END AS partner_id
+			FROM messages msg
+			JOIN matches m ON m.id = msg.matches_id
+			WHERE (m.userid1 = $1 OR m.userid2 = $1)
+			  AND ($3 = 0 OR m.id = $3)
+			  AND msg.search_vector @@ websearch_to_tsquery('simple', $2)
+			  AND msg.deleted_at IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = msg.id AND h.user_id = $1)
+			  AND ($4 = 0 OR (msg.created_at, msg.id) < (SELECT c.created_at, c.id FROM messages c WHERE c.id = $4))
+			ORDER BY msg.created_at DESC, msg.id DESC
+			LIMIT $5
+		)
+		SELECT hits.id, hits.matches_id, hits.sender_id, hits.partner_id, u.name,
+		       ts_headline('simple', hits.message, websearch_to_tsquery('simple', $2),
+		                   'StartSel=**, StopSel=**, MaxWords=20, MinWords=8, MaxFragments=1'),
+		       hits.created_at,
+		       (SELECT count(*)
+		        FROM messages newer
+		        WHERE newer.matches_id = hits.matches_id
+		          AND (newer.created_at, newer.id) >= (hits.created_at, hits.id)
+		          AND NOT EXISTS (SELECT 1 FROM message_hides h WHERE h.message_id = newer.id AND h.user_id = $1))
+		FROM hits
+		LEFT JOIN users u ON u.id = hits.partner_id
+		ORDER BY hits.created_at DESC, hits.id DESC
+	`, userID, q, matchesID, before, limit+1)
+	if err != nil {
+		log.Printf("Error searching messages: %v\n", err)
+		handleServerError(w, err, "Failed to search messages")
+		return
+	}
+	defer rows.Close()
+
+	results := []SearchHit{}
+	for rows.Next() {
+		var h SearchHit
+		if err := rows.Scan(&h.MessageID, &h.MatchesID, &h.SenderID, &h.PartnerID, &h.PartnerName,
+			&h.Snippet, &h.CreatedAt, &h.Position); err != nil {
+			log.Printf("Error scanning search hit: %v\n", err)
+			handleServerError(w, err, "Failed to scan search results")
+			return
+		}
+		results = append(results, h)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("Error iterating search hits: %v\n", err)
+		handleServerError(w, err, "Error searching messages")
+		return
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+		"hasMore": hasMore,
+	}); err != nil {
+		log.Printf("Error encoding response: %v\n", err)
+		handleServerError(w, err, "Failed to encode response")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseKeepAlive is how often an idle stream gets a comment line, so proxies do
+// not close it.
+const sseKeepAlive = 15 * time.Second
+
+// eventStream serves /api/events?token= as Server-Sent Events to the user of
+// the session token, for clients that cannot use the WebSocket. It carries
+// the same events. Events from the notifications table have an id, so a
+// reconnecting EventSource resumes with Last-Event-ID. Clients that manage the
+// connection themselves can pass lastEventId instead. As on the WebSocket,
+// the replay may repeat events the client already has.
+func eventStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	userID, ok := requireSession(w, r)
+	if !ok {
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var since int64
+	if lastEventID != "" {
+		var err error
+		since, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || since < 0 {
+			handleInvalidRequest(w, "Last-Event-ID must be an event id")
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		handleServerError(w, fmt.Errorf("streaming unsupported"), "Streaming is not supported")
+		return
+	}
+	if !requireActiveUser(w, userID) {
+		return
+	}
+
+	c := &hubClient{userID: userID, send: make(chan []byte, wsSendBuffer)}
+	hub.register(c)
+	defer hub.unregister(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	if since > 0 {
+		err := replayEvents(r.Context(), userID, since, func(e chatEvent) error {
+			data, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			writeSSE(w, data)
+			flusher.Flush()
+			return nil
+		})
+		if err != nil {
+			// Stream sudah dimulai; putus supaya browser reconnect dan mencoba lagi
+			log.Printf("Error sending missed events: %v\n", err)
+			return
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			if !ok {
+				// Hub memutus client yang lambat; browser akan reconnect sendiri
+				return
+			}
+			writeSSE(w, data)
+			flusher.Flush()
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSE writes one encoded chatEvent as an SSE message named after its
+// type.
+func writeSSE(w http.ResponseWriter, data []byte) {
+	var head struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"`
+	}
+	json.Unmarshal(data, &head)
+
+	if head.ID > 0 {
+		fmt.Fprintf(w, "id: %d\n", head.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", head.Type, data)
+}
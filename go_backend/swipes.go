@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// undoSwipeWindow is how long after a swipe the user can still take it back.
+var undoSwipeWindow = time.Duration(getEnvInt("UNDO_SWIPE_WINDOW_SECONDS", 300)) * time.Second
+
+// superLikeDailyQuota is the number of super likes a user gets per local day.
+var superLikeDailyQuota = getEnvInt("SUPER_LIKE_DAILY_QUOTA", 1)
+
+// superLikesRemaining counts today's super likes in the user's own timezone and
+// returns how many are left together with the time until the quota resets.
+func superLikesRemaining(ctx context.Context, q querier, userID int) (int, time.Duration, error) {
+	var used int
+	var resetIn float64
+	err := q.QueryRow(ctx, `
+		SELECT
+			(SELECT count(*)
+			 FROM swipes s
+			 WHERE s.user_id = u.id AND s.action = 'superlike' AND s.undone_at IS NULL
+			   AND s.created_at >= date_trunc('day', now() AT TIME ZONE u.timezone) AT TIME ZONE u.timezone),
+			EXTRACT(EPOCH FROM (date_trunc('day', now() AT TIME ZONE u.timezone) + interval '1 day') AT TIME ZONE u.timezone - now())::float8
+		FROM users u
+		WHERE u.id = $1
+	`, userID).Scan(&used, &resetIn)
+	if err != nil {
+		return 0, 0, err
+	}
+	return superLikeDailyQuota - used, time.Duration(resetIn * float64(time.Second)), nil
+}
+
+// recordSwipe stores a swipe together with the matches status it produced, so
+// that undoSwipe can tell whether the other side has acted since.
+func recordSwipe(ctx context.Context, q querier, userID, targetID, matchesID int, action, newStatus string) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO swipes (user_id, target_id, matches_id, action, new_status)
+		VALUES ($1, $2, $3, $4, $5)
+	`, userID, targetID, matchesID, action, newStatus)
+	return err
+}
+
+func undoSwipe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		handleInvalidRequest(w, "Method not allowed")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.URL.Query().Get("userid"))
+	if err != nil {
+		handleInvalidRequest(w, "userid is required")
+		return
+	}
+
+	var targetID int
+	var restoredStatus string
+	err = runSerializable(context.Background(), func(tx pgx.Tx) error {
+		var err error
+		targetID, restoredStatus, err = revertLastSwipe(context.Background(), tx, userID)
+		return err
+	})
+	if err != nil {
+		if writeClientError(w, err) {
+			return
+		}
+		log.Printf("Error undoing swipe: %v\n", err)
+		handleServerError(w, err, "Failed to undo swipe")
+		return
+	}
+
+	response := map[string]interface{}{"message": "Swipe undone", "userid2": targetID, "status": restoredStatus}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// revertLastSwipe clears userID's most recent decision, gives the swipe back
+// to the daily limit and returns the other user together with the restored
+// status ("" when the row was removed). When the swipe had made a match the
+// other user gets an "unmatched" event; an undone super like that did not
+// sends "swipe_undone".
+func revertLastSwipe(ctx context.Context, tx pgx.Tx, userID int) (int, string, error) {
+	var swipeID, targetID int
+	var matchesID *int
+	var action, newStatus string
+	var swipedAt time.Time
+	var undoable bool
+
+	err := tx.QueryRow(ctx, `
+		SELECT id, target_id, matches_id, action, new_status, created_at,
+		       created_at >= now() - $2::integer * interval '1 second'
+		FROM swipes
+		WHERE user_id = $1 AND undone_at IS NULL
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+		FOR UPDATE
+	`, userID, int(undoSwipeWindow.Seconds())).Scan(&swipeID, &targetID, &matchesID, &action, &newStatus, &swipedAt, &undoable)
+	if err == pgx.ErrNoRows {
+		return 0, "", &clientError{http.StatusNotFound, "No swipe to undo"}
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("fetching last swipe: %w", err)
+	}
+	if !undoable || matchesID == nil {
+		return 0, "", &clientError{http.StatusConflict, "Swipe can no longer be undone"}
+	}
+
+	var userID1 int
+	var decision1, decision2 *string
+	var currentStatus string
+	var hasMessages bool
+	err = tx.QueryRow(ctx, `
+		SELECT userid1, decision1, decision2, status,
+		       EXISTS (SELECT 1 FROM messages WHERE matches_id = matches.id)
+		FROM matches
+		WHERE id = $1
+		FOR UPDATE
+	`, *matchesID).Scan(&userID1, &decision1, &decision2, &currentStatus, &hasMessages)
+	if err != nil {
+		return 0, "", fmt.Errorf("fetching match: %w", err)
+	}
+
+	// Kalau user lain sudah merespon setelah swipe ini, jangan ditimpa
+	if currentStatus != newStatus {
+		return 0, "", &clientError{http.StatusConflict, "Match has changed since this swipe"}
+	}
+	if hasMessages {
+		return 0, "", &clientError{http.StatusConflict, "Conversation already started"}
+	}
+
+	if userID1 == userID {
+		decision1 = nil
+	} else {
+		decision2 = nil
+	}
+
+	restoredStatus := ""
+	if decision1 == nil && decision2 == nil {
+		_, err = tx.Exec(ctx, "DELETE FROM matches WHERE id = $1", *matchesID)
+	} else {
+		restoredStatus = matchStatus(decision1, decision2)
+		_, err = tx.Exec(ctx, "UPDATE matches SET decision1 = $1, decision2 = $2, status = $3 WHERE id = $4",
+			decision1, decision2, restoredStatus, *matchesID)
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("reverting match: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE swipes SET undone_at = now() WHERE id = $1", swipeID)
+	if err != nil {
+		return 0, "", fmt.Errorf("marking swipe undone: %w", err)
+	}
+	if err := refundSwipe(ctx, tx, userID, swipedAt); err != nil {
+		return 0, "", fmt.Errorf("refunding swipe: %w", err)
+	}
+
+	// Tarik kembali notifikasi match atau super like yang sudah diterima user lain
+	if newStatus == "match" {
+		err = notifyUser(ctx, tx, targetID, "unmatched", map[string]interface{}{"matchesId": *matchesID})
+	} else if action == decisionSuperLike {
+		err = notifyUser(ctx, tx, targetID, "swipe_undone", map[string]interface{}{"matchesId": *matchesID, "userId": userID})
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("sending undo notification: %w", err)
+	}
+
+	return targetID, restoredStatus, nil
+}
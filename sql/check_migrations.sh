@@ -0,0 +1,53 @@
+#!/bin/sh
+#
+# Checks that upgrading the baseline schema with every file in migrations/
+# ends up with the same schema as pawfectlypostgres.sql.
+#
+# Needs psql, pg_dump and a PostgreSQL server reachable through the usual
+# PGHOST/PGPORT/PGUSER/PGPASSWORD variables. Two scratch databases are
+# created and dropped again:
+#
+#   PGUSER=postgres PGPASSWORD=postgres sql/check_migrations.sh
+#
+
+set -eu
+
+cd "$(dirname "$0")"
+
+fresh=pawfectly_check_fresh
+upgraded=pawfectly_check_upgraded
+out=$(mktemp -d)
+
+cleanup() {
+    psql -q -d postgres -c "DROP DATABASE IF EXISTS $fresh" -c "DROP DATABASE IF EXISTS $upgraded" >/dev/null
+    rm -rf "$out"
+}
+trap cleanup EXIT
+
+psql -q -d postgres -c "DROP DATABASE IF EXISTS $fresh" -c "DROP DATABASE IF EXISTS $upgraded" \
+    -c "CREATE DATABASE $fresh" -c "CREATE DATABASE $upgraded" >/dev/null
+
+psql -q -v ON_ERROR_STOP=1 -d "$fresh" -f pawfectlypostgres.sql >/dev/null
+
+psql -q -v ON_ERROR_STOP=1 -d "$upgraded" -f baseline.sql >/dev/null
+for migration in migrations/*.sql; do
+    echo "Applying $migration"
+    psql -q -v ON_ERROR_STOP=1 -d "$upgraded" -f "$migration" >/dev/null
+done
+
+# Migrations 004 and later must be safe to run twice
+for migration in migrations/*.sql; do
+    case "$(basename "$migration")" in
+    00[1-3]_*) continue ;;
+    esac
+    psql -q -v ON_ERROR_STOP=1 -d "$upgraded" -f "$migration" >/dev/null
+done
+
+pg_dump --schema-only --no-owner --no-privileges "$fresh" | grep -v '^--' >"$out/fresh.sql"
+pg_dump --schema-only --no-owner --no-privileges "$upgraded" | grep -v '^--' >"$out/upgraded.sql"
+
+if ! diff -u "$out/fresh.sql" "$out/upgraded.sql"; then
+    echo "Migrated schema differs from pawfectlypostgres.sql" >&2
+    exit 1
+fi
+echo "Migrations match pawfectlypostgres.sql"
@@ -0,0 +1,34 @@
+--
+-- Convert messages.created_at from timestamp without time zone to timestamptz.
+--
+-- The old column was filled by now() and therefore holds wall-clock times in
+-- the database's TimeZone setting. Run this with the same TimeZone the server
+-- used (check with SHOW TimeZone) so existing rows keep their instant, e.g.
+--
+--   SET TimeZone = 'Asia/Jakarta';
+--   \i sql/migrations/001_messages_timestamptz.sql
+--
+
+BEGIN;
+
+ALTER TABLE public.messages
+    ALTER COLUMN created_at TYPE timestamp with time zone
+    USING created_at AT TIME ZONE current_setting('TimeZone');
+
+-- Rows without a timestamp are ordered by id anyway; give them the time of
+-- the previous message in the conversation, or the migration time.
+UPDATE public.messages msg
+SET created_at = COALESCE((
+    SELECT prev.created_at
+    FROM public.messages prev
+    WHERE prev.matches_id = msg.matches_id AND prev.id < msg.id AND prev.created_at IS NOT NULL
+    ORDER BY prev.id DESC
+    LIMIT 1
+), now())
+WHERE msg.created_at IS NULL;
+
+ALTER TABLE public.messages
+    ALTER COLUMN created_at SET DEFAULT now(),
+    ALTER COLUMN created_at SET NOT NULL;
+
+COMMIT;
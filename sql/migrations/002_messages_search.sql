@@ -0,0 +1,17 @@
+--
+-- Full-text search over messages (/api/searchMessages).
+--
+-- The 'simple' configuration only lowercases words, without stemming or stop
+-- words, so it works the same for English and Indonesian conversations.
+-- Adding the generated column rewrites the messages table.
+--
+
+BEGIN;
+
+ALTER TABLE public.messages
+    ADD COLUMN search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple'::regconfig, COALESCE(message, ''::character varying)::text)) STORED;
+
+CREATE INDEX messages_search_vector_idx ON public.messages USING gin (search_vector);
+
+COMMIT;
@@ -0,0 +1,101 @@
+--
+-- Store each side's swipe in matches.decision1/decision2 instead of a single
+-- status plus super_like, and keep one row per pair.
+--
+-- Before this change userid1 was the user who swiped first, so the old
+-- statuses translate to decisions as follows:
+--
+--   pending   userid1 liked (super liked when super_like), userid2 undecided
+--   match     both liked
+--   unmatch   one side passed. userid1 is assumed to have passed; when the
+--             swipe log shows that it was userid2, 006_matching.sql corrects
+--             it. Either way the pair stays unmatched.
+--
+-- super_like only exists on databases created from a schema that had it;
+-- elsewhere it is added as false so every like becomes a plain like.
+--
+-- Pairs stored twice (two concurrent first swipes) are merged into the row
+-- that is matched, has messages, or is oldest, in that order. A pass by
+-- either user wins, then a super like, then a like.
+--
+
+BEGIN;
+
+ALTER TABLE public.matches ADD COLUMN IF NOT EXISTS super_like boolean DEFAULT false NOT NULL;
+
+ALTER TABLE public.matches
+    ADD COLUMN decision1 character varying(255),
+    ADD COLUMN decision2 character varying(255);
+
+UPDATE public.matches
+SET decision1 = CASE WHEN status IN ('pending', 'match') THEN CASE WHEN super_like THEN 'superlike' ELSE 'like' END END,
+    decision2 = CASE WHEN status = 'match' THEN 'like' END;
+
+UPDATE public.matches SET decision1 = 'pass' WHERE status = 'unmatch';
+
+-- Merge duplicate pairs
+CREATE TEMPORARY TABLE match_pairs ON COMMIT DROP AS
+SELECT m.id, first_value(m.id) OVER (
+    PARTITION BY LEAST(m.userid1, m.userid2), GREATEST(m.userid1, m.userid2)
+    ORDER BY m.status = 'match' DESC,
+             EXISTS (SELECT 1 FROM public.messages msg WHERE msg.matches_id = m.id) DESC,
+             m.id
+) AS keep_id
+FROM public.matches m;
+
+CREATE TEMPORARY TABLE pair_decisions ON COMMIT DROP AS
+SELECT p.keep_id, x.user_id,
+       CASE WHEN bool_or(x.decision = 'pass') THEN 'pass'
+            WHEN bool_or(x.decision = 'superlike') THEN 'superlike'
+            WHEN bool_or(x.decision = 'like') THEN 'like'
+       END AS decision
+FROM match_pairs p
+JOIN public.matches m ON m.id = p.id
+CROSS JOIN LATERAL (VALUES (m.userid1, m.decision1), (m.userid2, m.decision2)) AS x (user_id, decision)
+WHERE p.keep_id IN (SELECT keep_id FROM match_pairs WHERE id <> keep_id)
+GROUP BY p.keep_id, x.user_id;
+
+UPDATE public.matches m
+SET decision1 = (SELECT d.decision FROM pair_decisions d WHERE d.keep_id = m.id AND d.user_id = m.userid1),
+    decision2 = (SELECT d.decision FROM pair_decisions d WHERE d.keep_id = m.id AND d.user_id = m.userid2)
+WHERE m.id IN (SELECT keep_id FROM pair_decisions);
+
+UPDATE public.matches
+SET status = CASE
+        WHEN decision1 = 'pass' OR decision2 = 'pass' THEN 'unmatch'
+        WHEN decision1 IN ('like', 'superlike') AND decision2 IN ('like', 'superlike') THEN 'match'
+        ELSE 'pending'
+    END
+WHERE id IN (SELECT keep_id FROM pair_decisions);
+
+UPDATE public.messages msg
+SET matches_id = p.keep_id
+FROM match_pairs p
+WHERE msg.matches_id = p.id AND p.id <> p.keep_id;
+
+-- Only databases that already have a swipe log; 006 creates it otherwise
+DO $$
+BEGIN
+    IF to_regclass('public.swipes') IS NOT NULL THEN
+        UPDATE public.swipes s
+        SET matches_id = p.keep_id
+        FROM match_pairs p
+        WHERE s.matches_id = p.id AND p.id <> p.keep_id;
+    END IF;
+END $$;
+
+DELETE FROM public.matches m
+USING match_pairs p
+WHERE m.id = p.id AND p.id <> p.keep_id;
+
+ALTER TABLE public.matches
+    ADD CONSTRAINT matches_decision1_check CHECK (decision1 IN ('like', 'superlike', 'pass')),
+    ADD CONSTRAINT matches_decision2_check CHECK (decision2 IN ('like', 'superlike', 'pass')),
+    DROP COLUMN super_like;
+
+CREATE UNIQUE INDEX matches_pair_idx ON public.matches USING btree (LEAST(userid1, userid2), GREATEST(userid1, userid2));
+
+-- Undo now restores decisions instead of the previous status
+ALTER TABLE IF EXISTS public.swipes DROP COLUMN IF EXISTS previous_status;
+
+COMMIT;
@@ -0,0 +1,22 @@
+--
+-- Profile, moderation and presence columns on users: location for distance
+-- filtering, the IANA timezone used for exports and calendars, the role and
+-- account state checked by moderation, and last-seen presence.
+--
+-- Existing users get timezone UTC; they can change it through /api/setProfile.
+--
+
+BEGIN;
+
+ALTER TABLE public.users
+    ADD COLUMN IF NOT EXISTS latitude double precision,
+    ADD COLUMN IF NOT EXISTS longitude double precision,
+    ADD COLUMN IF NOT EXISTS timezone character varying(64) DEFAULT 'UTC'::character varying NOT NULL,
+    ADD COLUMN IF NOT EXISTS role character varying(32) DEFAULT 'user'::character varying NOT NULL,
+    ADD COLUMN IF NOT EXISTS account_status character varying(32) DEFAULT 'active'::character varying NOT NULL,
+    ADD COLUMN IF NOT EXISTS suspended_until timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS warnings_count integer DEFAULT 0 NOT NULL,
+    ADD COLUMN IF NOT EXISTS last_seen_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS hide_online boolean DEFAULT false NOT NULL;
+
+COMMIT;
@@ -0,0 +1,96 @@
+--
+-- Message editing and deletion, photo and playdate messages, reactions and
+-- read receipts.
+--
+-- Existing messages become kind 'text'. Every participant's read position is
+-- set to the latest message of each conversation, so old conversations do
+-- not all show up as unread after the upgrade.
+--
+
+BEGIN;
+
+ALTER TABLE public.messages
+    ADD COLUMN IF NOT EXISTS edited_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS kind character varying(32) DEFAULT 'text'::character varying NOT NULL,
+    ADD COLUMN IF NOT EXISTS attachment_path character varying(255);
+
+ALTER TABLE public.messages DROP CONSTRAINT IF EXISTS messages_kind_check;
+ALTER TABLE public.messages
+    ADD CONSTRAINT messages_kind_check CHECK (kind IN ('text', 'image', 'playdate'));
+
+CREATE INDEX IF NOT EXISTS messages_matches_id_id_idx ON public.messages USING btree (matches_id, id);
+CREATE INDEX IF NOT EXISTS messages_matches_id_created_at_idx ON public.messages USING btree (matches_id, created_at, id);
+
+CREATE TABLE IF NOT EXISTS public.message_edits (
+    id SERIAL PRIMARY KEY,
+    message_id integer NOT NULL,
+    previous_message character varying(255) NOT NULL,
+    edited_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT message_edits_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS message_edits_message_id_idx ON public.message_edits USING btree (message_id);
+
+CREATE TABLE IF NOT EXISTS public.message_hides (
+    message_id integer NOT NULL,
+    user_id integer NOT NULL,
+    hidden_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (message_id, user_id),
+    CONSTRAINT message_hides_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT message_hides_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS public.message_reactions (
+    message_id integer NOT NULL,
+    user_id integer NOT NULL,
+    emoji character varying(16) NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (message_id, user_id),
+    CONSTRAINT message_reactions_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT message_reactions_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS public.playdates (
+    id SERIAL PRIMARY KEY,
+    matches_id integer NOT NULL,
+    message_id integer NOT NULL,
+    proposer_id integer NOT NULL,
+    starts_at timestamp with time zone NOT NULL,
+    duration_minutes integer DEFAULT 60 NOT NULL,
+    place character varying(255) NOT NULL,
+    status character varying(32) DEFAULT 'proposed'::character varying NOT NULL,
+    counter_of integer,
+    responded_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT playdates_status_check CHECK (status IN ('proposed', 'accepted', 'declined', 'countered')),
+    CONSTRAINT playdates_duration_check CHECK (duration_minutes > 0),
+    CONSTRAINT playdates_matchesid_fkey FOREIGN KEY (matches_id) REFERENCES public.matches(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT playdates_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT playdates_proposerid_fkey FOREIGN KEY (proposer_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT playdates_counterof_fkey FOREIGN KEY (counter_of) REFERENCES public.playdates(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS playdates_message_id_idx ON public.playdates USING btree (message_id);
+CREATE INDEX IF NOT EXISTS playdates_matches_id_starts_at_idx ON public.playdates USING btree (matches_id, starts_at);
+
+CREATE TABLE IF NOT EXISTS public.match_reads (
+    matches_id integer NOT NULL,
+    user_id integer NOT NULL,
+    last_read_message_id integer,
+    read_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (matches_id, user_id),
+    CONSTRAINT match_reads_matchesid_fkey FOREIGN KEY (matches_id) REFERENCES public.matches(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT match_reads_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT match_reads_lastreadmessageid_fkey FOREIGN KEY (last_read_message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+INSERT INTO public.match_reads (matches_id, user_id, last_read_message_id)
+SELECT m.id, u.user_id, (SELECT max(msg.id) FROM public.messages msg WHERE msg.matches_id = m.id)
+FROM public.matches m
+CROSS JOIN LATERAL (VALUES (m.userid1), (m.userid2)) AS u (user_id)
+WHERE u.user_id IS NOT NULL
+  AND EXISTS (SELECT 1 FROM public.messages msg WHERE msg.matches_id = m.id)
+ON CONFLICT (matches_id, user_id) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,83 @@
+--
+-- Matching: why and by whom a match was closed, match preferences, blocks,
+-- the swipe log used by undo, and the per-user rate limit buckets.
+--
+-- Run after 003_matches_decisions.sql. Matches that were unmatched before
+-- this migration keep closed_at empty.
+--
+-- 003 assumed that userid1 passed on every unmatched pair. Where the swipe
+-- log shows that userid2 passed after userid1's like, the decisions are
+-- corrected here; on databases without an earlier swipe log the table is new
+-- and nothing changes.
+--
+
+BEGIN;
+
+ALTER TABLE public.matches
+    ADD COLUMN IF NOT EXISTS closed_at timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS closed_by integer,
+    ADD COLUMN IF NOT EXISTS close_reason character varying(255);
+
+CREATE TABLE IF NOT EXISTS public.match_preferences (
+    user_id integer PRIMARY KEY,
+    pet_types character varying(255)[] DEFAULT '{}'::character varying[] NOT NULL,
+    pet_breeds character varying(255)[] DEFAULT '{}'::character varying[] NOT NULL,
+    gender character varying(255),
+    min_age integer,
+    max_age integer,
+    max_distance_km integer,
+    intent character varying(255) DEFAULT 'any'::character varying NOT NULL,
+    require_mutual boolean DEFAULT false NOT NULL,
+    CONSTRAINT match_preferences_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS public.blocks (
+    blocker_id integer NOT NULL,
+    blocked_id integer NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CONSTRAINT blocks_blockerid_fkey FOREIGN KEY (blocker_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT blocks_blockedid_fkey FOREIGN KEY (blocked_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS blocks_blocked_id_idx ON public.blocks USING btree (blocked_id);
+
+CREATE TABLE IF NOT EXISTS public.swipes (
+    id SERIAL PRIMARY KEY,
+    user_id integer NOT NULL,
+    target_id integer NOT NULL,
+    matches_id integer,
+    action character varying(255) NOT NULL,
+    new_status character varying(255) NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    undone_at timestamp with time zone,
+    CONSTRAINT swipes_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT swipes_targetid_fkey FOREIGN KEY (target_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT swipes_matchesid_fkey FOREIGN KEY (matches_id) REFERENCES public.matches(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS swipes_user_id_created_at_idx ON public.swipes USING btree (user_id, created_at DESC);
+
+UPDATE public.matches m
+SET decision1 = CASE WHEN EXISTS (
+        SELECT 1 FROM public.swipes s
+        WHERE s.matches_id = m.id AND s.user_id = m.userid1 AND s.action = 'superlike' AND s.undone_at IS NULL
+    ) THEN 'superlike' ELSE 'like' END,
+    decision2 = 'pass'
+WHERE m.status = 'unmatch' AND m.decision1 = 'pass' AND m.decision2 IS NULL
+  AND EXISTS (
+      SELECT 1 FROM public.swipes s
+      WHERE s.matches_id = m.id AND s.user_id = m.userid2 AND s.new_status = 'unmatch' AND s.undone_at IS NULL
+  );
+
+CREATE TABLE IF NOT EXISTS public.rate_limits (
+    user_id integer NOT NULL,
+    bucket character varying(255) NOT NULL,
+    window_start timestamp with time zone NOT NULL,
+    window_end timestamp with time zone NOT NULL,
+    count integer DEFAULT 0 NOT NULL,
+    PRIMARY KEY (user_id, bucket),
+    CONSTRAINT rate_limits_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+COMMIT;
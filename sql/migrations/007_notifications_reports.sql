@@ -0,0 +1,39 @@
+--
+-- The stored event log behind /api/notifications and the live event streams,
+-- and user reports for moderation.
+--
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS public.notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id integer NOT NULL,
+    type character varying(255) NOT NULL,
+    payload jsonb DEFAULT '{}'::jsonb NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT notifications_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_id_idx ON public.notifications USING btree (user_id, id);
+
+CREATE TABLE IF NOT EXISTS public.reports (
+    id SERIAL PRIMARY KEY,
+    reporter_id integer,
+    reported_user_id integer NOT NULL,
+    message_id integer,
+    category character varying(64) NOT NULL,
+    details character varying(1000),
+    status character varying(32) DEFAULT 'open'::character varying NOT NULL,
+    moderator_id integer,
+    resolution_note text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    resolved_at timestamp with time zone,
+    CONSTRAINT reports_reporterid_fkey FOREIGN KEY (reporter_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE SET NULL,
+    CONSTRAINT reports_reporteduserid_fkey FOREIGN KEY (reported_user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT reports_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE SET NULL,
+    CONSTRAINT reports_moderatorid_fkey FOREIGN KEY (moderator_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS reports_status_created_at_idx ON public.reports USING btree (status, created_at);
+
+COMMIT;
@@ -0,0 +1,13 @@
+--
+-- Playdate calendar feeds are looked up by a secret key instead of the user
+-- id. Keys are created when the user first asks for the feed address, so
+-- existing subscriptions by user id stop working and have to be re-added.
+--
+
+BEGIN;
+
+ALTER TABLE public.users ADD COLUMN IF NOT EXISTS calendar_token character varying(64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_calendar_token_idx ON public.users USING btree (calendar_token);
+
+COMMIT;
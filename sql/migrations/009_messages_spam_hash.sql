@@ -0,0 +1,11 @@
+--
+-- The spam filter compares new messages with a hash of the sender's recent
+-- original texts, because the stored text may be masked. Older messages have
+-- no hash; the filter hashes their stored text instead.
+--
+
+BEGIN;
+
+ALTER TABLE public.messages ADD COLUMN IF NOT EXISTS spam_hash character varying(64);
+
+COMMIT;
@@ -4,9 +4,18 @@ CREATE TABLE public.matches (
     id SERIAL PRIMARY KEY,
     status character varying(255) DEFAULT 'pending'::character varying NOT NULL,
     userid1 integer,
-    userid2 integer
+    userid2 integer,
+    decision1 character varying(255),
+    decision2 character varying(255),
+    closed_at timestamp with time zone,
+    closed_by integer,
+    close_reason character varying(255),
+    CONSTRAINT matches_decision1_check CHECK (decision1 IN ('like', 'superlike', 'pass')),
+    CONSTRAINT matches_decision2_check CHECK (decision2 IN ('like', 'superlike', 'pass'))
 );
 
+CREATE UNIQUE INDEX matches_pair_idx ON public.matches USING btree (LEAST(userid1, userid2), GREATEST(userid1, userid2));
+
 
 --
 -- TOC entry 212 (class 1259 OID 16842)
@@ -18,10 +27,132 @@ CREATE TABLE public.messages (
     message character varying(255),
     matches_id integer NOT NULL,
     sender_id integer NOT NULL,
-    created_at timestamp without time zone DEFAULT now()
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    search_vector tsvector GENERATED ALWAYS AS (to_tsvector('simple'::regconfig, COALESCE(message, ''::character varying)::text)) STORED,
+    edited_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    kind character varying(32) DEFAULT 'text'::character varying NOT NULL,
+    attachment_path character varying(255),
+    spam_hash character varying(64),
+    CONSTRAINT messages_kind_check CHECK (kind IN ('text', 'image', 'playdate'))
+);
+
+CREATE INDEX messages_matches_id_id_idx ON public.messages USING btree (matches_id, id);
+
+CREATE INDEX messages_matches_id_created_at_idx ON public.messages USING btree (matches_id, created_at, id);
+
+CREATE INDEX messages_search_vector_idx ON public.messages USING gin (search_vector);
+
+
+--
+-- Name: message_edits; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.message_edits (
+    id SERIAL PRIMARY KEY,
+    message_id integer NOT NULL,
+    previous_message character varying(255) NOT NULL,
+    edited_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX message_edits_message_id_idx ON public.message_edits USING btree (message_id);
+
+
+--
+-- Name: message_hides; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.message_hides (
+    message_id integer NOT NULL,
+    user_id integer NOT NULL,
+    hidden_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (message_id, user_id)
+);
+
+
+--
+-- Name: message_reactions; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.message_reactions (
+    message_id integer NOT NULL,
+    user_id integer NOT NULL,
+    emoji character varying(16) NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (message_id, user_id)
 );
 
 
+--
+-- Name: playdates; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.playdates (
+    id SERIAL PRIMARY KEY,
+    matches_id integer NOT NULL,
+    message_id integer NOT NULL,
+    proposer_id integer NOT NULL,
+    starts_at timestamp with time zone NOT NULL,
+    duration_minutes integer DEFAULT 60 NOT NULL,
+    place character varying(255) NOT NULL,
+    status character varying(32) DEFAULT 'proposed'::character varying NOT NULL,
+    counter_of integer,
+    responded_at timestamp with time zone,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT playdates_status_check CHECK (status IN ('proposed', 'accepted', 'declined', 'countered')),
+    CONSTRAINT playdates_duration_check CHECK (duration_minutes > 0)
+);
+
+CREATE UNIQUE INDEX playdates_message_id_idx ON public.playdates USING btree (message_id);
+
+CREATE INDEX playdates_matches_id_starts_at_idx ON public.playdates USING btree (matches_id, starts_at);
+
+
+--
+-- Name: match_reads; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.match_reads (
+    matches_id integer NOT NULL,
+    user_id integer NOT NULL,
+    last_read_message_id integer,
+    read_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (matches_id, user_id)
+);
+
+
+
+--
+-- Name: swipes; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.swipes (
+    id SERIAL PRIMARY KEY,
+    user_id integer NOT NULL,
+    target_id integer NOT NULL,
+    matches_id integer,
+    action character varying(255) NOT NULL,
+    new_status character varying(255) NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    undone_at timestamp with time zone
+);
+
+CREATE INDEX swipes_user_id_created_at_idx ON public.swipes USING btree (user_id, created_at DESC);
+
+
+--
+-- Name: rate_limits; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.rate_limits (
+    user_id integer NOT NULL,
+    bucket character varying(255) NOT NULL,
+    window_start timestamp with time zone NOT NULL,
+    window_end timestamp with time zone NOT NULL,
+    count integer DEFAULT 0 NOT NULL,
+    PRIMARY KEY (user_id, bucket)
+);
+
 
 CREATE TABLE public.users (
     id SERIAL PRIMARY KEY,
@@ -34,7 +165,82 @@ CREATE TABLE public.users (
     name character varying(255),
     age integer,
     city character varying(255),
-    bio character varying(255)
+    bio character varying(255),
+    latitude double precision,
+    longitude double precision,
+    timezone character varying(64) DEFAULT 'UTC'::character varying NOT NULL,
+    role character varying(32) DEFAULT 'user'::character varying NOT NULL,
+    account_status character varying(32) DEFAULT 'active'::character varying NOT NULL,
+    suspended_until timestamp with time zone,
+    warnings_count integer DEFAULT 0 NOT NULL,
+    last_seen_at timestamp with time zone,
+    hide_online boolean DEFAULT false NOT NULL,
+    calendar_token character varying(64)
+);
+
+CREATE UNIQUE INDEX users_calendar_token_idx ON public.users USING btree (calendar_token);
+
+
+--
+-- Name: reports; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.reports (
+    id SERIAL PRIMARY KEY,
+    reporter_id integer,
+    reported_user_id integer NOT NULL,
+    message_id integer,
+    category character varying(64) NOT NULL,
+    details character varying(1000),
+    status character varying(32) DEFAULT 'open'::character varying NOT NULL,
+    moderator_id integer,
+    resolution_note text,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    resolved_at timestamp with time zone
+);
+
+CREATE INDEX reports_status_created_at_idx ON public.reports USING btree (status, created_at);
+
+
+--
+-- Name: blocks; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.blocks (
+    blocker_id integer NOT NULL,
+    blocked_id integer NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
+CREATE INDEX blocks_blocked_id_idx ON public.blocks USING btree (blocked_id);
+
+
+--
+-- Name: notifications; Type: TABLE; Schema: public; Owner: postgres
+--
+
+CREATE TABLE public.notifications (
+    id BIGSERIAL PRIMARY KEY,
+    user_id integer NOT NULL,
+    type character varying(255) NOT NULL,
+    payload jsonb DEFAULT '{}'::jsonb NOT NULL,
+    created_at timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX notifications_user_id_id_idx ON public.notifications USING btree (user_id, id);
+
+
+CREATE TABLE public.match_preferences (
+    user_id integer PRIMARY KEY,
+    pet_types character varying(255)[] DEFAULT '{}'::character varying[] NOT NULL,
+    pet_breeds character varying(255)[] DEFAULT '{}'::character varying[] NOT NULL,
+    gender character varying(255),
+    min_age integer,
+    max_age integer,
+    max_distance_km integer,
+    intent character varying(255) DEFAULT 'any'::character varying NOT NULL,
+    require_mutual boolean DEFAULT false NOT NULL
 );
 
 
@@ -72,3 +278,130 @@ ALTER TABLE ONLY public.messages
 
 ALTER TABLE ONLY public.messages
     ADD CONSTRAINT senderid_fkey FOREIGN KEY (sender_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: match_preferences match_preferences_userid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.match_preferences
+    ADD CONSTRAINT match_preferences_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: swipes swipes_userid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.swipes
+    ADD CONSTRAINT swipes_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.swipes
+    ADD CONSTRAINT swipes_targetid_fkey FOREIGN KEY (target_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.swipes
+    ADD CONSTRAINT swipes_matchesid_fkey FOREIGN KEY (matches_id) REFERENCES public.matches(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: notifications notifications_userid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.notifications
+    ADD CONSTRAINT notifications_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: rate_limits rate_limits_userid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.rate_limits
+    ADD CONSTRAINT rate_limits_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: blocks blocks_blockerid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.blocks
+    ADD CONSTRAINT blocks_blockerid_fkey FOREIGN KEY (blocker_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.blocks
+    ADD CONSTRAINT blocks_blockedid_fkey FOREIGN KEY (blocked_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: reports reports_reporterid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.reports
+    ADD CONSTRAINT reports_reporterid_fkey FOREIGN KEY (reporter_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+ALTER TABLE ONLY public.reports
+    ADD CONSTRAINT reports_reporteduserid_fkey FOREIGN KEY (reported_user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.reports
+    ADD CONSTRAINT reports_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+ALTER TABLE ONLY public.reports
+    ADD CONSTRAINT reports_moderatorid_fkey FOREIGN KEY (moderator_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: match_reads match_reads_matchesid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.match_reads
+    ADD CONSTRAINT match_reads_matchesid_fkey FOREIGN KEY (matches_id) REFERENCES public.matches(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.match_reads
+    ADD CONSTRAINT match_reads_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.match_reads
+    ADD CONSTRAINT match_reads_lastreadmessageid_fkey FOREIGN KEY (last_read_message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE SET NULL;
+
+
+--
+-- Name: message_edits message_edits_messageid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.message_edits
+    ADD CONSTRAINT message_edits_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: message_hides message_hides_messageid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.message_hides
+    ADD CONSTRAINT message_hides_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.message_hides
+    ADD CONSTRAINT message_hides_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: message_reactions message_reactions_messageid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.message_reactions
+    ADD CONSTRAINT message_reactions_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.message_reactions
+    ADD CONSTRAINT message_reactions_userid_fkey FOREIGN KEY (user_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+
+--
+-- Name: playdates playdates_matchesid_fkey; Type: FK CONSTRAINT; Schema: public; Owner: postgres
+--
+
+ALTER TABLE ONLY public.playdates
+    ADD CONSTRAINT playdates_matchesid_fkey FOREIGN KEY (matches_id) REFERENCES public.matches(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.playdates
+    ADD CONSTRAINT playdates_messageid_fkey FOREIGN KEY (message_id) REFERENCES public.messages(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.playdates
+    ADD CONSTRAINT playdates_proposerid_fkey FOREIGN KEY (proposer_id) REFERENCES public.users(id) ON UPDATE CASCADE ON DELETE CASCADE;
+
+ALTER TABLE ONLY public.playdates
+    ADD CONSTRAINT playdates_counterof_fkey FOREIGN KEY (counter_of) REFERENCES public.playdates(id) ON UPDATE CASCADE ON DELETE SET NULL;
@@ -1,6 +1,6 @@
 import React from "react";
 
-const BubbleMessage = ({ message, isOwn }) => {
+const BubbleMessage = ({ message, image, isOwn }) => {
   const bubbleClasses = `rounded-lg p-4 mb-2 max-w-lg mt-2 ${
     isOwn
       ? "bg-yellow-300 text-gray-700 ml-auto"
@@ -9,7 +9,8 @@ const BubbleMessage = ({ message, isOwn }) => {
 
   return (
     <div className={bubbleClasses}>
-      <p>{message}</p>
+      {image && <img src={image} alt="" className="rounded-md mb-2" />}
+      {message && <p>{message}</p>}
     </div>
   );
 };
@@ -36,13 +36,14 @@ export default function ListMessage() {
             matchesId={room.matchesId}
             profilePic={room.profilePic}
             lastMessage={room.lastMessage}
-            lastMessageTime={new Date(room.lastMessageTime).toLocaleTimeString(
-              [],
-              {
-                hour: "2-digit",
-                minute: "2-digit",
-              }
-            )}
+            lastMessageTime={
+              room.lastMessageTime
+                ? new Date(room.lastMessageTime).toLocaleTimeString([], {
+                    hour: "2-digit",
+                    minute: "2-digit",
+                  })
+                : ""
+            }
           />
         ))}
       </div>
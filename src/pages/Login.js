@@ -25,6 +25,7 @@ function Login() {
         const data = await response.json();
         console.log(data);
         localStorage.setItem("userID", data.user_id);
+        localStorage.setItem("token", data.token);
         localStorage.setItem("imagePet", data.image_pet);
 
         localStorage.setItem("petType", data.petType);
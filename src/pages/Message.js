@@ -7,6 +7,7 @@ import { useLocation, useNavigate } from "react-router-dom";
 function Message() {
   const [messages, setMessages] = useState([]);
   const idLogin = parseInt(localStorage.getItem("userID"));
+  const token = localStorage.getItem("token");
   const location = useLocation();
   const { matchesId } = location.state || {};
   const navigate = useNavigate();
@@ -20,7 +21,7 @@ function Message() {
     const fetchMessages = async () => {
       try {
         const response = await fetch(
-          `http://localhost:8082/api/messages?matchesId=${matchesId}`
+          `http://localhost:8082/api/messages?matchesId=${matchesId}&userId=${idLogin}`
         );
         const data = await response.json();
         setMessages(data.messages || []);
@@ -44,7 +45,11 @@ function Message() {
         {messages.map((message, index) => (
           <BubbleMessage
             key={index}
-            message={message.message}
+            message={message.deleted ? "message deleted" : message.message}
+            image={
+              message.attachmentUrl &&
+              `http://localhost:8082${message.attachmentUrl}&token=${encodeURIComponent(token)}`
+            }
             isOwn={message.senderId === idLogin}
           />
         ))}
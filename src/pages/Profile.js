@@ -72,6 +72,11 @@ function Profile() {
     formData.append("city", city);
     formData.append("bio", bio);
     formData.append("id", id);
+    // timezone IANA dari browser, misal Asia/Jakarta
+    formData.append(
+      "timezone",
+      Intl.DateTimeFormat().resolvedOptions().timeZone || ""
+    );
 
     try {
       const response = await fetch("http://localhost:8082/api/setProfile", {
@@ -29,6 +29,7 @@ export default function Signup() {
           console.log(data);
           localStorage.setItem("isLogin", true);
           localStorage.setItem("userID", data.user_id);
+          localStorage.setItem("token", data.token);
           navigate("/preprofile");
           console.log("Signup success");
         } else {